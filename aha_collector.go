@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	aha "github.com/ndecker/fritzbox_exporter/fritzbox_aha"
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ahaLabels = []string{"gateway", "ain", "name", "product"}
+
+	ahaPresentDesc = prometheus.NewDesc("fritzbox_aha_device_present",
+		"Smart home device is connected (1) or not (0).", ahaLabels, nil)
+	ahaSwitchStateDesc = prometheus.NewDesc("fritzbox_aha_switch_state",
+		"Switch state of a smart home plug (on = 1).", ahaLabels, nil)
+	ahaPowerDesc = prometheus.NewDesc("fritzbox_aha_power_watts",
+		"Current power consumption in watts.", ahaLabels, nil)
+	ahaEnergyDesc = prometheus.NewDesc("fritzbox_aha_energy_watt_hours_total",
+		"Total energy consumption in watt hours.", ahaLabels, nil)
+	ahaVoltageDesc = prometheus.NewDesc("fritzbox_aha_voltage_volts",
+		"Current voltage in volts.", ahaLabels, nil)
+	ahaTemperatureDesc = prometheus.NewDesc("fritzbox_aha_temperature_celsius",
+		"Temperature measured by the device in °C (offset applied).", ahaLabels, nil)
+	ahaThermostatCurrentDesc = prometheus.NewDesc("fritzbox_aha_thermostat_current_celsius",
+		"Current temperature measured by the thermostat in °C.", ahaLabels, nil)
+	ahaThermostatTargetDesc = prometheus.NewDesc("fritzbox_aha_thermostat_target_celsius",
+		"Target temperature of the thermostat in °C.", ahaLabels, nil)
+	ahaBatteryDesc = prometheus.NewDesc("fritzbox_aha_battery_percent",
+		"Battery level in percent.", ahaLabels, nil)
+	ahaHumidityDesc = prometheus.NewDesc("fritzbox_aha_humidity_percent",
+		"Relative humidity in percent.", ahaLabels, nil)
+)
+
+// AHACollector collects smart home devices through the AHA-HTTP interface.
+type AHACollector struct {
+	gateway string
+	client  *aha.Client
+}
+
+func NewAHACollector(params upnp.ConnectionParameters) (*AHACollector, error) {
+	scheme := "http"
+	if params.UseTLS {
+		scheme = "https"
+	}
+
+	tlsConfig, err := upnp.NewTLSConfig(params)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return &AHACollector{
+		gateway: params.Device,
+		client: aha.NewClient(fmt.Sprintf("%s://%s", scheme, params.Device),
+			params.Username, params.Password, httpClient),
+	}, nil
+}
+
+func (ac *AHACollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ahaPresentDesc
+	ch <- ahaSwitchStateDesc
+	ch <- ahaPowerDesc
+	ch <- ahaEnergyDesc
+	ch <- ahaVoltageDesc
+	ch <- ahaTemperatureDesc
+	ch <- ahaThermostatCurrentDesc
+	ch <- ahaThermostatTargetDesc
+	ch <- ahaBatteryDesc
+	ch <- ahaHumidityDesc
+}
+
+func (ac *AHACollector) Collect(ch chan<- prometheus.Metric) {
+	numCalls.Inc()
+	devices, err := ac.client.DeviceList()
+	if err != nil {
+		logError("cannot read smart home devices", err)
+		return
+	}
+
+	for _, d := range devices {
+		labels := []string{ac.gateway, d.Identifier, d.Name, d.ProductName}
+		gauge := func(desc *prometheus.Desc, val float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, val, labels...)
+		}
+
+		gauge(ahaPresentDesc, float64(d.Present))
+		if d.Present == 0 {
+			// all other values are invalid
+			continue
+		}
+
+		if d.Switch != nil && d.Switch.State != "" {
+			gauge(ahaSwitchStateDesc, boolFloat(d.Switch.State == "1"))
+		}
+		if d.PowerMeter != nil {
+			gauge(ahaPowerDesc, float64(d.PowerMeter.Power)/1000)
+			gauge(ahaVoltageDesc, float64(d.PowerMeter.Voltage)/1000)
+			ch <- prometheus.MustNewConstMetric(ahaEnergyDesc, prometheus.CounterValue,
+				float64(d.PowerMeter.Energy), labels...)
+		}
+		if d.Temperature != nil {
+			gauge(ahaTemperatureDesc, float64(d.Temperature.Celsius)/10)
+		}
+		if d.Thermostat != nil {
+			if t, ok := aha.ThermostatCelsius(d.Thermostat.Current); ok {
+				gauge(ahaThermostatCurrentDesc, t)
+			}
+			if t, ok := aha.ThermostatCelsius(d.Thermostat.Target); ok {
+				gauge(ahaThermostatTargetDesc, t)
+			}
+		}
+		if d.Battery != nil {
+			gauge(ahaBatteryDesc, float64(*d.Battery))
+		}
+		if d.Humidity != nil {
+			gauge(ahaHumidityDesc, float64(d.Humidity.RelHumidity))
+		}
+	}
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
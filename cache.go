@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// cacheKey identifies an action call.
+type cacheKey struct {
+	Service string
+	Action  string
+}
+
+// resultCache caches action results across scrapes.
+// Concurrent requests for the same action are coalesced into a single call.
+type resultCache struct {
+	mu      sync.Mutex               // protects entries and results
+	entries map[cacheKey]*cacheEntry // latest call; might be in progress
+	results map[cacheKey]*cacheEntry // latest successful call
+}
+
+type cacheEntry struct {
+	done   chan struct{} // closed when the call is finished
+	result upnp.Result
+	err    error
+	time   time.Time // start time of the call
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{
+		entries: make(map[cacheKey]*cacheEntry),
+		results: make(map[cacheKey]*cacheEntry),
+	}
+}
+
+// get returns the cached result for key if it is younger than maxAge.
+// Otherwise call is used to get a new result. If a call for key is already running, its result is used.
+// Errors are not cached.
+func (c *resultCache) get(key cacheKey, maxAge time.Duration, call func() (upnp.Result, error)) *cacheEntry {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		select {
+		case <-e.done:
+			ok = e.err == nil && time.Since(e.time) < maxAge
+		default:
+			// call in progress
+		}
+	}
+
+	if ok {
+		c.mu.Unlock()
+		<-e.done
+		return e
+	}
+
+	e = &cacheEntry{
+		done: make(chan struct{}),
+		time: time.Now(),
+	}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.result, e.err = call()
+	close(e.done)
+
+	if e.err == nil {
+		c.mu.Lock()
+		c.results[key] = e
+		c.mu.Unlock()
+	}
+	return e
+}
+
+// latest returns the latest successful result for key or nil if there is none.
+func (c *resultCache) latest(key cacheKey) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results[key]
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const onTelService = "urn:dslforum-org:service:X_AVM-DE_OnTel:1"
+
+// call types of the call list
+var callListTypes = map[int]string{
+	1:  "incoming",
+	2:  "missed",
+	3:  "outgoing",
+	9:  "active_incoming",
+	10: "blocked",
+	11: "active_outgoing",
+}
+
+// CallListCollector counts the calls of the call list (X_AVM-DE_OnTel GetCallList).
+// Only calls that are new since the last scrape are read.
+type CallListCollector struct {
+	fc   *FritzboxCollector
+	days int // days of history read at the first scrape
+
+	sync.Mutex // protects lastId
+	lastId     int
+
+	calls    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+type callList struct {
+	Calls []struct {
+		Id       int    `xml:"Id"`
+		Type     int    `xml:"Type"`
+		Device   string `xml:"Device"`
+		Port     string `xml:"Port"`
+		Duration string `xml:"Duration"` // h:mm
+	} `xml:"Call"`
+}
+
+func NewCallListCollector(fc *FritzboxCollector, days int) *CallListCollector {
+	return &CallListCollector{
+		fc:   fc,
+		days: days,
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fritzbox_calllist_calls_total",
+			Help: "Number of calls in the call list by type (incoming, missed, outgoing, blocked), port and device.",
+		}, []string{"gateway", "type", "port", "device"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "fritzbox_calllist_call_duration_seconds",
+			Help:    "Duration of calls in the call list (minute resolution).",
+			Buckets: []float64{60, 120, 300, 600, 1200, 1800, 3600, 7200},
+		}, []string{"gateway", "type"}),
+	}
+}
+
+func (cc *CallListCollector) Describe(ch chan<- *prometheus.Desc) {
+	cc.calls.Describe(ch)
+	cc.duration.Describe(ch)
+}
+
+func (cc *CallListCollector) Collect(ch chan<- prometheus.Metric) {
+	cc.Lock()
+	defer cc.Unlock()
+
+	err := cc.update()
+	if err != nil {
+		logError("cannot read call list", err)
+	}
+
+	cc.calls.Collect(ch)
+	cc.duration.Collect(ch)
+}
+
+// update reads all calls since the last update
+func (cc *CallListCollector) update() error {
+	cc.fc.RLock()
+	defer cc.fc.RUnlock()
+
+	service, ok := cc.fc.services[onTelService]
+	if !ok {
+		serviceNotFound.WithLabelValues(onTelService).Inc()
+		return nil
+	}
+	action, ok := service.Actions["GetCallList"]
+	if !ok {
+		actionNotFound.WithLabelValues("GetCallList").Inc()
+		return nil
+	}
+
+	numCalls.Inc()
+	res, err := action.Call()
+	if err != nil {
+		return err
+	}
+	val, _ := action.Value(res, "NewCallListURL")
+	listUrl, ok := val.(string)
+	if !ok || listUrl == "" {
+		resultNotFound.WithLabelValues("NewCallListURL").Inc()
+		return nil
+	}
+
+	u, err := url.Parse(listUrl)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	if cc.lastId == 0 {
+		q.Set("days", strconv.Itoa(cc.days))
+	} else {
+		q.Set("id", strconv.Itoa(cc.lastId))
+	}
+	u.RawQuery = q.Encode()
+
+	body, err := service.Fetch(u.String())
+	if err != nil {
+		return err
+	}
+
+	var list callList
+	err = xml.Unmarshal(body, &list)
+	if err != nil {
+		return fmt.Errorf("cannot parse call list: %w", err)
+	}
+
+	sort.Slice(list.Calls, func(i, j int) bool { return list.Calls[i].Id < list.Calls[j].Id })
+
+	gateway := cc.fc.Parameters.Device
+	for _, c := range list.Calls {
+		if c.Id <= cc.lastId {
+			continue
+		}
+		if c.Type == 9 || c.Type == 11 {
+			// call in progress; counted when it is finished
+			break
+		}
+		cc.lastId = c.Id
+
+		typ, ok := callListTypes[c.Type]
+		if !ok {
+			typ = strconv.Itoa(c.Type)
+		}
+		cc.calls.WithLabelValues(gateway, typ, c.Port, c.Device).Inc()
+
+		if d, ok := parseCallDuration(c.Duration); ok {
+			cc.duration.WithLabelValues(gateway, typ).Observe(d.Seconds())
+		}
+	}
+	return nil
+}
+
+// parseCallDuration parses durations of the form h:mm
+func parseCallDuration(s string) (time.Duration, bool) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(m)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, true
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+
+	callmonitor "github.com/ndecker/fritzbox_exporter/fritzbox_callmonitor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	callLabels = []string{"gateway", "direction", "line", "sip"}
+
+	callsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fritzbox_callmonitor_calls_total",
+		Help: "Number of calls by direction (incoming, outgoing), own number and SIP account.",
+	}, callLabels)
+	callsMissed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fritzbox_callmonitor_missed_calls_total",
+		Help: "Number of incoming calls that were not answered.",
+	}, []string{"gateway", "line", "sip"})
+	callDuration = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fritzbox_callmonitor_call_duration_seconds_total",
+		Help: "Total duration of answered calls.",
+	}, callLabels)
+	callsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fritzbox_callmonitor_active_calls",
+		Help: "Number of calls in progress (ringing or connected).",
+	}, []string{"gateway"})
+	callMonitorConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fritzbox_callmonitor_connected",
+		Help: "Connection to the call monitor is established.",
+	}, []string{"gateway"})
+
+	callMonitorMetrics = []prometheus.Collector{callsTotal, callsMissed, callDuration, callsActive, callMonitorConnected}
+)
+
+// activeCall is a call between RING/CALL and DISCONNECT
+type activeCall struct {
+	direction string
+	line      string // own number
+	sip       string
+	connected bool
+}
+
+// callTracker counts the events of the call monitor.
+type callTracker struct {
+	gateway string
+
+	sync.Mutex                        // protects calls
+	calls      map[string]*activeCall // indexed by connection id
+}
+
+// startCallMonitor connects to the call monitor of the device in the background.
+func startCallMonitor(device string, port int) {
+	t := &callTracker{
+		gateway: device,
+		calls:   make(map[string]*activeCall),
+	}
+
+	m := &callmonitor.Monitor{
+		Address:      net.JoinHostPort(device, strconv.Itoa(port)),
+		OnEvent:      t.handleEvent,
+		OnConnection: t.handleConnection,
+		OnError: func(err error) {
+			logError("call monitor error", err)
+		},
+	}
+	go m.Run()
+}
+
+func (t *callTracker) handleConnection(connected bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if connected {
+		slog.Info("connected to call monitor")
+		callMonitorConnected.WithLabelValues(t.gateway).Set(1)
+	} else {
+		callMonitorConnected.WithLabelValues(t.gateway).Set(0)
+	}
+
+	// calls in progress can not be tracked across connections
+	t.calls = make(map[string]*activeCall)
+	callsActive.WithLabelValues(t.gateway).Set(0)
+}
+
+func (t *callTracker) handleEvent(ev callmonitor.Event) {
+	t.Lock()
+	defer t.Unlock()
+
+	switch ev.Type {
+	case callmonitor.Ring:
+		t.startCall(ev.ConnectionId, &activeCall{direction: "incoming", line: ev.Callee, sip: ev.Line})
+	case callmonitor.Call:
+		t.startCall(ev.ConnectionId, &activeCall{direction: "outgoing", line: ev.Caller, sip: ev.Line})
+	case callmonitor.Connect:
+		if c, ok := t.calls[ev.ConnectionId]; ok {
+			c.connected = true
+		}
+	case callmonitor.Disconnect:
+		c, ok := t.calls[ev.ConnectionId]
+		if !ok {
+			return // call started before the connection to the call monitor
+		}
+		delete(t.calls, ev.ConnectionId)
+		callsActive.WithLabelValues(t.gateway).Set(float64(len(t.calls)))
+
+		if c.connected {
+			callDuration.WithLabelValues(t.gateway, c.direction, c.line, c.sip).Add(ev.Duration.Seconds())
+		} else if c.direction == "incoming" {
+			callsMissed.WithLabelValues(t.gateway, c.line, c.sip).Inc()
+		}
+	}
+}
+
+func (t *callTracker) startCall(id string, c *activeCall) {
+	t.calls[id] = c
+	callsTotal.WithLabelValues(t.gateway, c.direction, c.line, c.sip).Inc()
+	callsActive.WithLabelValues(t.gateway).Set(float64(len(t.calls)))
+}
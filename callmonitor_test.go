@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	callmonitor "github.com/ndecker/fritzbox_exporter/fritzbox_callmonitor"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCallTracker(t *testing.T) {
+	const gw = "test.callmonitor"
+	tr := &callTracker{gateway: gw, calls: make(map[string]*activeCall)}
+
+	events := []callmonitor.Event{
+		// missed incoming call
+		{Type: callmonitor.Ring, ConnectionId: "0", Caller: "0301234567", Callee: "987654", Line: "SIP0"},
+		{Type: callmonitor.Disconnect, ConnectionId: "0"},
+		// answered incoming call
+		{Type: callmonitor.Ring, ConnectionId: "1", Caller: "0301234567", Callee: "987654", Line: "SIP0"},
+		{Type: callmonitor.Connect, ConnectionId: "1", Extension: "10", Number: "0301234567"},
+		{Type: callmonitor.Disconnect, ConnectionId: "1", Duration: 90 * time.Second},
+		// outgoing call, not answered
+		{Type: callmonitor.Call, ConnectionId: "2", Extension: "10", Caller: "987654", Callee: "0301234567", Line: "SIP0"},
+		{Type: callmonitor.Disconnect, ConnectionId: "2"},
+		// outgoing call in progress
+		{Type: callmonitor.Call, ConnectionId: "3", Extension: "10", Caller: "987654", Callee: "0301234567", Line: "SIP0"},
+		{Type: callmonitor.Connect, ConnectionId: "3", Extension: "10", Number: "0301234567"},
+		// call started before the connection
+		{Type: callmonitor.Disconnect, ConnectionId: "9", Duration: time.Hour},
+	}
+	for _, ev := range events {
+		tr.handleEvent(ev)
+	}
+
+	checks := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"incoming calls", testutil.ToFloat64(callsTotal.WithLabelValues(gw, "incoming", "987654", "SIP0")), 2},
+		{"outgoing calls", testutil.ToFloat64(callsTotal.WithLabelValues(gw, "outgoing", "987654", "SIP0")), 2},
+		{"missed calls", testutil.ToFloat64(callsMissed.WithLabelValues(gw, "987654", "SIP0")), 1},
+		{"incoming duration", testutil.ToFloat64(callDuration.WithLabelValues(gw, "incoming", "987654", "SIP0")), 90},
+		{"outgoing duration", testutil.ToFloat64(callDuration.WithLabelValues(gw, "outgoing", "987654", "SIP0")), 0},
+		{"active calls", testutil.ToFloat64(callsActive.WithLabelValues(gw)), 1},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	// calls in progress are dropped with the connection
+	tr.handleConnection(false)
+	if got := testutil.ToFloat64(callsActive.WithLabelValues(gw)); got != 0 {
+		t.Errorf("active calls after connection loss: got %v, want 0", got)
+	}
+}
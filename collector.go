@@ -1,17 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const serviceLoadRetryTime = 1 * time.Minute
 
+// resolveRetryTime is the minimum time between resolving the services again
+const resolveRetryTime = 1 * time.Minute
+
 var (
 	numCalls = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "fritzbox_exporter_calls",
@@ -35,56 +40,168 @@ var (
 		Help: "",
 	}, []string{"result"})
 
-	collectMetrics = []prometheus.Collector{numCalls, collectErrors, serviceNotFound, actionNotFound, resultNotFound}
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_http_requests_total",
+		Help: "Number of HTTP requests to the FRITZ!Box UPnP service by status code.",
+	}, []string{"code"})
+
+	tlsCertExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "fritzbox_exporter_tls_cert_expiry_timestamp_seconds",
+		Help: "Expiry time of the TLS certificate of the FRITZ!Box.",
+	})
+	tlsPinMismatches = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_tls_pin_mismatches_total",
+		Help: "Number of TLS connections rejected because the certificate did not match the pin.",
+	})
+
+	collectMetrics = []prometheus.Collector{numCalls, collectErrors, serviceNotFound, actionNotFound, resultNotFound,
+		httpRequests, tlsCertExpiry, tlsPinMismatches}
 )
 
 type FritzboxCollector struct {
 	Parameters upnp.ConnectionParameters
 	Metrics    []*Metric
 
-	sync.RWMutex // protects services
-	services     map[string]*upnp.Service
+	sync.RWMutex                          // protects roots, services, serviceList, instances, resolved and probed
+	roots        map[string]*upnp.Root    // indexed by service descriptor
+	services     map[string]*upnp.Service // indexed by type; the first service of a type is used
+	serviceList  []*upnp.Service          // all services in the order of the service descriptors
+	instances    map[string]*upnp.Service // indexed by instance
+
+	cache        *resultCache
+	resolved     map[cacheKey][]string      // service instances for each metric
+	probed       map[cacheKey]bool          // metrics whose service instance was selected by probing
+	servicesGen  int                        // incremented when the services are replaced
+	minIntervals map[cacheKey]time.Duration // minimum refresh interval per action
+	pollInterval time.Duration              // background polling interval; 0 if disabled
+
+	statusMu   sync.Mutex // protects the fields below
+	igdLoaded  bool
+	tr64Loaded bool
+	lastScrape scrapeStatus
+	pollStatus map[cacheKey]error // latest poll result per action
+
+	resolveMu   sync.Mutex // protects the fields below
+	resolving   bool       // services are resolved again in the background
+	lastResolve time.Time
+}
+
+// scrapeStatus records if the last scrape could reach the device.
+type scrapeStatus struct {
+	Time time.Time
+	Err  error // last call error if no call succeeded
 }
 
 func NewCollector(params upnp.ConnectionParameters, metrics []*Metric) *FritzboxCollector {
 	c := &FritzboxCollector{
 		Parameters: params,
 		Metrics:    metrics,
+		roots:      make(map[string]*upnp.Root),
 		services:   make(map[string]*upnp.Service),
+		instances:  make(map[string]*upnp.Service),
+
+		resolved:     make(map[cacheKey][]string),
+		probed:       make(map[cacheKey]bool),
+		cache:        newResultCache(),
+		minIntervals: make(map[cacheKey]time.Duration),
+		pollStatus:   make(map[cacheKey]error),
+	}
+
+	// The refresh interval of an action is the longest interval of all metrics using it.
+	for _, m := range metrics {
+		key := m.key()
+		if d, ok := c.minIntervals[key]; !ok || m.MinInterval > d {
+			c.minIntervals[key] = m.MinInterval
+		}
 	}
+
 	go c.loadServices()
 	return c
 }
 
 // LoadServices tries to load the service information. Retries until success.
+// Cached service descriptions are used until the device answers.
 func (fc *FritzboxCollector) loadServices() {
-	igdRoot := fc.loadService(upnp.IGDServiceDescriptor)
-	log.Printf("%d IGD services loaded\n", len(igdRoot.Services))
-	fc.Lock()
-	for _, s := range igdRoot.Services {
-		fc.services[s.ServiceType] = s
+	descriptors := []string{upnp.IGDServiceDescriptor}
+	if fc.Parameters.Username != "" {
+		descriptors = append(descriptors, upnp.TR64ServiceDescriptor)
 	}
-	fc.Unlock()
+
+	if fc.Parameters.CacheDir != "" {
+		for _, desc := range descriptors {
+			root, err := upnp.LoadCachedServiceRoot(fc.Parameters, desc)
+			if err != nil {
+				slog.Info("no cached services", "descriptor", desc, "error", err)
+				continue
+			}
+			slog.Info("services loaded from cache", "descriptor", desc, "count", len(root.Services))
+			fc.setRoot(desc, root)
+		}
+	}
+
+	igdRoot := fc.loadService(upnp.IGDServiceDescriptor)
+	slog.Info("IGD services loaded", "count", len(igdRoot.Services))
+	fc.setRoot(upnp.IGDServiceDescriptor, igdRoot)
 
 	if fc.Parameters.Username == "" {
-		log.Printf("no username set: not loading TR64 services")
+		slog.Info("no username set: not loading TR64 services")
 		return
 	}
 	tr64Root := fc.loadService(upnp.TR64ServiceDescriptor)
-	log.Printf("%d TR64 services loaded\n", len(tr64Root.Services))
+	slog.Info("TR64 services loaded", "count", len(tr64Root.Services))
+	fc.setRoot(upnp.TR64ServiceDescriptor, tr64Root)
+}
+
+// setRoot sets the services of a service descriptor and resolves the services of all metrics again.
+func (fc *FritzboxCollector) setRoot(desc string, root *upnp.Root) {
 	fc.Lock()
-	for _, s := range tr64Root.Services {
-		fc.services[s.ServiceType] = s
+	fc.roots[desc] = root
+	fc.servicesGen++
+
+	fc.services = make(map[string]*upnp.Service)
+	fc.serviceList = nil
+	fc.instances = make(map[string]*upnp.Service)
+	for _, d := range []string{upnp.IGDServiceDescriptor, upnp.TR64ServiceDescriptor} {
+		r, ok := fc.roots[d]
+		if !ok {
+			continue
+		}
+		for _, s := range r.ServiceList {
+			if first, ok := fc.services[s.ServiceType]; ok {
+				slog.Warn("several services of the same type: the first one is used by default",
+					"type", s.ServiceType, "used", first.Instance, "ignored", s.Instance)
+			} else {
+				fc.services[s.ServiceType] = s
+			}
+			fc.serviceList = append(fc.serviceList, s)
+			fc.instances[s.Instance] = s
+		}
 	}
 	fc.Unlock()
+
+	// services are only modified by loadServices; no lock needed for reading
+	resolved, probed := fc.resolveServices()
+
+	fc.Lock()
+	fc.resolved = resolved
+	fc.probed = probed
+	fc.Unlock()
+
+	fc.statusMu.Lock()
+	switch desc {
+	case upnp.IGDServiceDescriptor:
+		fc.igdLoaded = true
+	case upnp.TR64ServiceDescriptor:
+		fc.tr64Loaded = true
+	}
+	fc.statusMu.Unlock()
 }
 
 func (fc *FritzboxCollector) loadService(desc string) *upnp.Root {
 	for {
-		root, err := upnp.LoadServiceRoot(fc.Parameters, desc)
+		root, err := upnp.LoadServiceRootContext(context.Background(), fc.Parameters, desc)
 		if err != nil {
-			collectErrors.Inc()
-			fmt.Printf("cannot load services: %s\n", err)
+			logError("cannot load services", err, "descriptor", desc)
 
 			time.Sleep(serviceLoadRetryTime)
 			continue
@@ -97,83 +214,244 @@ func (fc *FritzboxCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range fc.Metrics {
 		ch <- m.desc
 	}
+	if fc.pollInterval > 0 {
+		ch <- pollAgeDesc
+		ch <- pollLastSuccessDesc
+	}
 }
 
 func (fc *FritzboxCollector) Collect(ch chan<- prometheus.Metric) {
-	fc.RLock()
-	defer fc.RUnlock()
+	fc.collect(context.Background(), ch)
+}
 
-	type cacheKey struct {
-		Service string
-		Action  string
+// collect collects the metrics in a trace span. The context carries the trace context of the scrape.
+func (fc *FritzboxCollector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	ctx, span := tracer.Start(ctx, "Collect")
+	defer span.End()
+
+	if fc.pollInterval > 0 {
+		span.SetAttributes(attribute.Bool("polled", true))
+		fc.collectPolled(ch)
+		return
 	}
 
+	fc.RLock()
+	defer fc.RUnlock()
+
 	// Cache Action call result. Multiple metrics might use different results from a call.
-	resultCache := make(map[cacheKey]upnp.Result)
+	scrapeResults := make(map[cacheKey]*cacheEntry)
+	start := time.Now()
 
-	for _, m := range fc.Metrics {
-		result, ok := resultCache[cacheKey{
-			Service: m.Service,
-			Action:  m.Action,
-		}]
+	var numOk int
+	var lastErr error
+	defer func() {
+		if numOk == 0 && lastErr == nil {
+			return // no calls made, e.g. services not loaded yet
+		}
+		if numOk > 0 {
+			lastErr = nil
+		}
+		fc.setScrapeStatus(lastErr)
+	}()
 
+	for _, m := range fc.Metrics {
+		key := m.key()
+		instances, ok := fc.resolved[key]
 		if !ok {
-			service, ok := fc.services[m.Service]
+			serviceNotFound.WithLabelValues(key.Service).Inc()
+			continue
+		}
+
+		for _, instance := range instances {
+			callKey := cacheKey{Service: instance, Action: m.Action}
+			entry, ok := scrapeResults[callKey]
+
 			if !ok {
-				serviceNotFound.WithLabelValues(m.Service).Inc()
-				continue
+				entry = fc.callAction(ctx, callKey, fc.minIntervals[key])
+				scrapeResults[callKey] = entry
+				if entry == nil {
+					continue
+				}
+				if entry.err != nil {
+					lastErr = entry.err
+					continue
+				}
+				if !entry.time.Before(start) {
+					// only calls of this scrape show that the device is reachable; not cached results
+					numOk++
+				}
 			}
-			action, ok := service.Actions[m.Action]
-			if !ok {
-				actionNotFound.WithLabelValues(m.Action).Inc()
+			if entry == nil || entry.err != nil {
 				continue
 			}
 
-			numCalls.Inc()
-			var err error
-			result, err = action.Call()
-			if err != nil {
-				fmt.Println(err)
-				collectErrors.Inc()
-				continue
-			}
+			fc.exportResult(ch, m, key, instance, entry)
+		}
+	}
+}
 
-			resultCache[cacheKey{
-				Service: m.Service,
-				Action:  m.Action,
-			}] = result
+// callAction calls the action of a service instance through the result cache.
+// Returns nil if the action is not available. The caller must hold the read lock.
+func (fc *FritzboxCollector) callAction(ctx context.Context, callKey cacheKey, maxAge time.Duration) *cacheEntry {
+	service, ok := fc.instances[callKey.Service]
+	if !ok {
+		serviceNotFound.WithLabelValues(callKey.Service).Inc()
+		return nil
+	}
+	action, ok := service.Actions[callKey.Action]
+	if !ok {
+		actionNotFound.WithLabelValues(callKey.Action).Inc()
+		return nil
+	}
+
+	entry := fc.cache.get(callKey, maxAge, func() (upnp.Result, error) {
+		numCalls.Inc()
+		// the call is shared with concurrent scrapes; it is not canceled with this scrape
+		return action.CallContext(context.WithoutCancel(ctx), nil)
+	})
+	if entry.err != nil {
+		logError("action call failed", entry.err, "service", callKey.Service, "action", callKey.Action)
+	}
+	return entry
+}
+
+func (fc *FritzboxCollector) setScrapeStatus(err error) {
+	fc.statusMu.Lock()
+	fc.lastScrape = scrapeStatus{Time: time.Now(), Err: err}
+	fc.statusMu.Unlock()
+}
+
+func (fc *FritzboxCollector) exportResult(ch chan<- prometheus.Metric, m *Metric, key cacheKey, instance string, entry *cacheEntry) {
+	val, ok := entry.result[m.Result]
+	if !ok {
+		resultNotFound.WithLabelValues(m.Result).Inc()
+		return
+	}
+	fc.checkResolved(m, key, val)
+
+	if val64, ok := toUint64(entry.result[m.Result64]); ok && m.Result64 != "" {
+		// prefer 64 bit counter if the device has one
+		val = val64
+	} else if m.wrap != nil {
+		if raw, ok := toUint64(val); ok {
+			val = m.wrap.update(instance, raw, entry.time, func() (time.Time, bool) {
+				return fc.bootTime(entry.time)
+			})
 		}
+	}
 
-		val, ok := result[m.Result]
-		if !ok {
-			resultNotFound.WithLabelValues(m.Result).Inc()
-			continue
+	var metrics []prometheus.Metric
+	if m.Enum {
+		metrics = fc.exportEnum(m, val, instance)
+	} else {
+		metrics = []prometheus.Metric{fc.exportMetric(m, val, instance)}
+	}
+
+	for _, metric := range metrics {
+		if fc.minIntervals[key] > 0 {
+			// cached results are reported with the time of the call
+			metric = prometheus.NewMetricWithTimestamp(entry.time, metric)
+		}
+		ch <- metric
+	}
+}
+
+// bootTime returns the time the device was started from the uptime reported by DeviceInfo GetInfo (TR64).
+// The uptime is read after the time at. With polling the polled uptime is used; it is unknown if it was
+// not polled after at. The caller must hold the read lock.
+func (fc *FritzboxCollector) bootTime(at time.Time) (time.Time, bool) {
+	service, ok := fc.services[deviceInfoService]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	key := cacheKey{Service: service.Instance, Action: "GetInfo"}
+	var entry *cacheEntry
+	if fc.pollInterval > 0 {
+		// Collect only reads the polled results
+		entry = fc.cache.latest(key)
+		if entry != nil && entry.time.Before(at) {
+			entry = nil
+		}
+	} else {
+		entry = fc.callAction(context.Background(), key, time.Since(at))
+	}
+	if entry == nil || entry.err != nil {
+		return time.Time{}, false
+	}
+	uptime, ok := toUint64(entry.result["NewUpTime"])
+	if !ok {
+		return time.Time{}, false
+	}
+	return entry.time.Add(-time.Duration(uptime) * time.Second), true
+}
+
+// exportEnum exports one series per allowed value of the result. A value that is not in the list of allowed
+// values is exported as well. The caller must hold the read lock.
+func (fc *FritzboxCollector) exportEnum(m *Metric, val interface{}, instance string) []prometheus.Metric {
+	labels := []string{fc.Parameters.Device}
+	if m.Fanout {
+		labels = append(labels, instance)
+	}
+
+	var allowed []string
+	if service, ok := fc.instances[instance]; ok {
+		for _, v := range service.StateVariables {
+			if v.Name == m.Result {
+				allowed = v.AllowedValueList
+			}
 		}
+	}
 
-		fc.exportMetric(m, ch, val)
+	current := fmt.Sprintf("%v", val)
+	found := false
+
+	var metrics []prometheus.Metric
+	for _, state := range allowed {
+		var value float64
+		if state == current {
+			value = 1
+			found = true
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			m.desc, m.metricType, value,
+			append(labels, state)...,
+		))
+	}
+	if !found {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			m.desc, m.metricType, 1,
+			append(labels, current)...,
+		))
 	}
+	return metrics
 }
 
-func (fc *FritzboxCollector) exportMetric(m *Metric, ch chan<- prometheus.Metric, val interface{}) {
+func (fc *FritzboxCollector) exportMetric(m *Metric, val interface{}, instance string) prometheus.Metric {
+	labels := []string{fc.Parameters.Device}
+	if m.Fanout {
+		labels = append(labels, instance)
+	}
+
 	if m.LabelName == "" {
 		// normal metric
 
 		floatVal, ok := toFloat(val, m.OkValue)
 		if !ok {
-			log.Println("cannot convert to float:", val)
+			slog.Warn("cannot convert to float", "metric", m.Metric, "value", val)
 			collectErrors.Inc()
 		}
 
-		ch <- prometheus.MustNewConstMetric(
+		return prometheus.MustNewConstMetric(
 			m.desc, m.metricType, floatVal,
-			fc.Parameters.Device,
+			labels...,
 		)
 	} else {
 		// value as label metric
 		stringVal := fmt.Sprintf("%s", val)
-		ch <- prometheus.MustNewConstMetric(
+		return prometheus.MustNewConstMetric(
 			m.desc, m.metricType, 1.0,
-			fc.Parameters.Device, stringVal,
+			append(labels, stringVal)...,
 		)
 	}
 }
@@ -182,6 +460,10 @@ func toFloat(val any, okValue string) (float64, bool) {
 	switch val := val.(type) {
 	case uint64:
 		return float64(val), true
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
 	case bool:
 		if val {
 			return 1, true
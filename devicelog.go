@@ -0,0 +1,247 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+const deviceInfoService = "urn:dslforum-org:service:DeviceInfo:1"
+
+//go:embed default-log-rules.yaml
+var defaultLogRulesYaml []byte
+
+// logRule classifies entries of the event log
+type logRule struct {
+	Category string
+	Regex    string
+
+	regex *regexp.Regexp
+}
+
+// logEntry is an entry of the event log of the FRITZ!Box
+type logEntry struct {
+	Time     time.Time // zero if the entry has no time
+	Message  string
+	Line     string // raw line
+	Category string
+}
+
+func loadLogRules(data []byte) ([]*logRule, error) {
+	var rules []*logRule
+
+	err := yaml.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rules {
+		if r.Category == "" {
+			return nil, fmt.Errorf("log rule %q: no category", r.Regex)
+		}
+		r.regex, err = regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("log rule %s: %w", r.Category, err)
+		}
+	}
+	return rules, nil
+}
+
+// classify returns the category of the first matching rule or "other".
+func classify(rules []*logRule, message string) string {
+	for _, r := range rules {
+		if r.regex.MatchString(message) {
+			return r.Category
+		}
+	}
+	return "other"
+}
+
+// deviceLogReader reads new entries of the event log of the FRITZ!Box (DeviceInfo GetDeviceLog).
+type deviceLogReader struct {
+	fc    *FritzboxCollector
+	rules []*logRule
+
+	sync.Mutex                // protects the fields below
+	seen       map[string]int // lines of the last read log and how often they occurred
+	primed     bool           // a log was read
+}
+
+func newDeviceLogReader(fc *FritzboxCollector, rules []*logRule) *deviceLogReader {
+	return &deviceLogReader{
+		fc:    fc,
+		rules: rules,
+		seen:  make(map[string]int),
+	}
+}
+
+// read returns the classified entries that are new since the last read, oldest first.
+// first is true if no log was read before.
+func (r *deviceLogReader) read() (entries []logEntry, first bool, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	lines, err := r.readLog()
+	if err != nil || lines == nil {
+		return nil, false, err
+	}
+	first = !r.primed
+	return r.newEntries(lines), first, nil
+}
+
+// readLog returns the lines of the device log. Returns nil if the device log is not available.
+func (r *deviceLogReader) readLog() ([]string, error) {
+	r.fc.RLock()
+	defer r.fc.RUnlock()
+
+	service, ok := r.fc.services[deviceInfoService]
+	if !ok {
+		serviceNotFound.WithLabelValues(deviceInfoService).Inc()
+		return nil, nil
+	}
+
+	var text string
+	if action, ok := service.Actions["GetDeviceLog"]; ok {
+		numCalls.Inc()
+		res, err := action.Call()
+		if err != nil {
+			return nil, err
+		}
+		val, _ := action.Value(res, "NewDeviceLog")
+		text, _ = val.(string)
+	} else if action, ok := service.Actions["X_AVM-DE_GetDeviceLogPath"]; ok {
+		numCalls.Inc()
+		res, err := action.Call()
+		if err != nil {
+			return nil, err
+		}
+		val, _ := action.Value(res, "NewDeviceLogPath")
+		path, _ := val.(string)
+		if path == "" {
+			resultNotFound.WithLabelValues("NewDeviceLogPath").Inc()
+			return nil, nil
+		}
+		data, err := service.Fetch(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	} else {
+		actionNotFound.WithLabelValues("GetDeviceLog").Inc()
+		return nil, nil
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// newEntries returns the entries that were not in the last read log, oldest first.
+// Identical lines are counted, so a repeated line is a new entry if it occurs more often than in the last log.
+func (r *deviceLogReader) newEntries(lines []string) []logEntry {
+	var entries []logEntry
+	seen := make(map[string]int, len(lines))
+
+	// the device log is sorted newest first
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		seen[line]++
+		if r.seen[line] > 0 {
+			r.seen[line]--
+			continue
+		}
+
+		e := parseLogLine(line)
+		e.Category = classify(r.rules, e.Message)
+		entries = append(entries, e)
+	}
+
+	r.seen = seen
+	r.primed = true
+	return entries
+}
+
+// DeviceLogCollector counts the entries of the event log of the FRITZ!Box.
+// Entries are only counted once. The entries in the log at the start of the exporter are not counted.
+type DeviceLogCollector struct {
+	reader *deviceLogReader
+	events *prometheus.CounterVec
+}
+
+func NewDeviceLogCollector(fc *FritzboxCollector, rules []*logRule) *DeviceLogCollector {
+	return &DeviceLogCollector{
+		reader: newDeviceLogReader(fc, rules),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fritzbox_log_events_total",
+			Help: "Number of entries in the event log of the FRITZ!Box by category.",
+		}, []string{"gateway", "category"}),
+	}
+}
+
+func (dc *DeviceLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	dc.events.Describe(ch)
+}
+
+func (dc *DeviceLogCollector) Collect(ch chan<- prometheus.Metric) {
+	entries, first, err := dc.reader.read()
+	if err != nil {
+		logError("cannot read device log", err)
+	}
+	if first {
+		// the existing entries are not new events
+		entries = nil
+	}
+
+	for _, e := range entries {
+		dc.events.WithLabelValues(dc.reader.fc.Parameters.Device, e.Category).Inc()
+	}
+
+	dc.events.Collect(ch)
+}
+
+// parseLogLine parses lines of the form "02.01.06 15:04:05 message"
+func parseLogLine(line string) logEntry {
+	const timeLayout = "02.01.06 15:04:05"
+
+	e := logEntry{Line: line, Message: line}
+	if len(line) > len(timeLayout) {
+		t, err := time.ParseInLocation(timeLayout, line[:len(timeLayout)], time.Local)
+		if err == nil {
+			e.Time = t
+			e.Message = strings.TrimSpace(line[len(timeLayout):])
+		}
+	}
+	return e
+}
+
+// loadLogRulesFile loads the log rules from a file or the default rules if file is empty
+func loadLogRulesFile(file string) ([]*logRule, error) {
+	data := defaultLogRulesYaml
+	if file != "" {
+		var err error
+		data, err = os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rules, err := loadLogRules(data)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("loaded log rules", "count", len(rules))
+	return rules, nil
+}
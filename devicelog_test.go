@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDeviceLogNewEntries(t *testing.T) {
+	r := newDeviceLogReader(nil, nil)
+
+	// newest first
+	first := []string{
+		"05.03.24 18:31:00 WLAN-Gerät angemeldet",
+		"05.03.24 18:30:15 Internetverbindung wurde erfolgreich hergestellt.",
+	}
+	if got := r.newEntries(first); len(got) != 2 {
+		t.Fatalf("first read: got %d entries, want 2", len(got))
+	}
+
+	second := []string{
+		"05.03.24 18:31:00 WLAN-Gerät angemeldet", // repeated within the same second
+		"05.03.24 18:31:00 WLAN-Gerät angemeldet",
+		"05.03.24 18:30:15 Internetverbindung wurde erfolgreich hergestellt.",
+	}
+	got := r.newEntries(second)
+	if len(got) != 1 || got[0].Line != second[0] {
+		t.Errorf("repeated line: got %v, want one new entry", got)
+	}
+
+	// the oldest entry was removed from the log
+	third := second[:2]
+	if got := r.newEntries(third); len(got) != 0 {
+		t.Errorf("rotated log: got %v, want no new entries", got)
+	}
+}
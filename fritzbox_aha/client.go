@@ -0,0 +1,121 @@
+// Package fritzbox_aha queries smart home devices through the AHA-HTTP interface of Fritz!Box devices.
+package fritzbox_aha
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// errSessionInvalid is returned if the FRITZ!Box rejects the session id.
+var errSessionInvalid = errors.New("session invalid")
+
+// Client for the AHA-HTTP interface (/webservices/homeautoswitch.lua).
+// The session id is cached and renewed if it expires.
+type Client struct {
+	baseUrl  string
+	username string
+	password string
+	client   *http.Client
+
+	mu  sync.Mutex // protects sid
+	sid string
+}
+
+// NewClient creates a client for the FRITZ!Box web interface at baseUrl (e.g. http://fritz.box).
+func NewClient(baseUrl string, username string, password string, client *http.Client) *Client {
+	return &Client{
+		baseUrl:  strings.TrimSuffix(baseUrl, "/"),
+		username: username,
+		password: password,
+		client:   client,
+	}
+}
+
+// command calls a switchcmd of homeautoswitch.lua. A new session is created if there is none or
+// if the current one has expired.
+func (c *Client) command(cmd string, params url.Values) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for retry := 0; ; retry++ {
+		if c.sid == "" {
+			sid, err := c.login()
+			if err != nil {
+				return nil, err
+			}
+			c.sid = sid
+		}
+
+		values := url.Values{}
+		for k, v := range params {
+			values[k] = v
+		}
+		values.Set("switchcmd", cmd)
+		values.Set("sid", c.sid)
+
+		body, err := c.get(c.baseUrl + "/webservices/homeautoswitch.lua?" + values.Encode())
+		if errors.Is(err, errSessionInvalid) && retry == 0 {
+			c.sid = ""
+			continue
+		}
+		return body, err
+	}
+}
+
+func (c *Client) get(url string) ([]byte, error) {
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(resp)
+}
+
+func (c *Client) post(url string, form url.Values) ([]byte, error) {
+	resp, err := c.client.PostForm(url, form)
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(resp)
+}
+
+func readResponse(resp *http.Response) ([]byte, error) {
+	defer closeIgnoringError(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusForbidden:
+		return nil, errSessionInvalid
+	default:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// closeIgnoringError closes c an ignores errors
+func closeIgnoringError(c io.Closer) {
+	_ = c.Close()
+}
@@ -0,0 +1,87 @@
+package fritzbox_aha
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Device is a smart home device as reported by getdevicelistinfos.
+// Optional sections are nil if the device does not have the function.
+type Device struct {
+	Identifier      string `xml:"identifier,attr"` // AIN
+	Id              string `xml:"id,attr"`
+	FunctionBitmask int    `xml:"functionbitmask,attr"`
+	FirmwareVersion string `xml:"fwversion,attr"`
+	Manufacturer    string `xml:"manufacturer,attr"`
+	ProductName     string `xml:"productname,attr"`
+
+	Present    int    `xml:"present"`
+	Name       string `xml:"name"`
+	Battery    *int   `xml:"battery"`    // battery level in percent
+	BatteryLow *int   `xml:"batterylow"` // 1 if battery is low
+
+	Switch      *Switch      `xml:"switch"`
+	PowerMeter  *PowerMeter  `xml:"powermeter"`
+	Temperature *Temperature `xml:"temperature"`
+	Thermostat  *Thermostat  `xml:"hkr"`
+	Humidity    *Humidity    `xml:"humidity"`
+}
+
+type Switch struct {
+	State string `xml:"state"` // "1", "0" or empty if unknown
+	Mode  string `xml:"mode"`  // auto or manuell
+}
+
+type PowerMeter struct {
+	Voltage int `xml:"voltage"` // mV
+	Power   int `xml:"power"`   // mW
+	Energy  int `xml:"energy"`  // Wh
+}
+
+type Temperature struct {
+	Celsius int `xml:"celsius"` // 0.1 °C
+	Offset  int `xml:"offset"`  // 0.1 °C
+}
+
+// Thermostat (Heizkörperregler) temperatures are in 0.5 °C steps.
+// 253 means off and 254 means on.
+type Thermostat struct {
+	Current int `xml:"tist"`
+	Target  int `xml:"tsoll"`
+}
+
+type Humidity struct {
+	RelHumidity int `xml:"rel_humidity"` // percent
+}
+
+const (
+	ThermostatOff = 253
+	ThermostatOn  = 254
+)
+
+// ThermostatCelsius converts a thermostat temperature to °C. ok is false for the values off and on.
+func ThermostatCelsius(val int) (celsius float64, ok bool) {
+	if val == ThermostatOff || val == ThermostatOn {
+		return 0, false
+	}
+	return float64(val) / 2, true
+}
+
+type deviceList struct {
+	Devices []*Device `xml:"device"`
+}
+
+// DeviceList returns all smart home devices.
+func (c *Client) DeviceList() ([]*Device, error) {
+	body, err := c.command("getdevicelistinfos", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list deviceList
+	err = xml.Unmarshal(body, &list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse device list: %w; body: %s", err, body)
+	}
+	return list.Devices, nil
+}
@@ -0,0 +1,130 @@
+package fritzbox_aha
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// invalidSID is returned by the FRITZ!Box if a login failed or a session is invalid.
+const invalidSID = "0000000000000000"
+
+var ErrLoginFailed = errors.New("login failed")
+
+type sessionInfo struct {
+	SID       string `xml:"SID"`
+	Challenge string `xml:"Challenge"`
+	BlockTime int    `xml:"BlockTime"`
+}
+
+// login performs the challenge/response login of login_sid.lua and returns a new session id.
+func (c *Client) login() (string, error) {
+	info, err := c.sessionInfo(nil)
+	if err != nil {
+		return "", err
+	}
+	if info.BlockTime > 0 {
+		return "", fmt.Errorf("%w: login blocked for %d seconds", ErrLoginFailed, info.BlockTime)
+	}
+
+	response, err := challengeResponse(info.Challenge, c.password)
+	if err != nil {
+		return "", err
+	}
+
+	info, err = c.sessionInfo(url.Values{
+		"username": {c.username},
+		"response": {response},
+	})
+	if err != nil {
+		return "", err
+	}
+	if info.SID == invalidSID || info.SID == "" {
+		return "", fmt.Errorf("%w: invalid username or password", ErrLoginFailed)
+	}
+	return info.SID, nil
+}
+
+func (c *Client) sessionInfo(form url.Values) (*sessionInfo, error) {
+	loginUrl := c.baseUrl + "/login_sid.lua?version=2"
+
+	var body []byte
+	var err error
+	if form == nil {
+		body, err = c.get(loginUrl)
+	} else {
+		body, err = c.post(loginUrl, form)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info sessionInfo
+	err = xml.Unmarshal(body, &info)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse session info: %w", err)
+	}
+	return &info, nil
+}
+
+// challengeResponse computes the login response for PBKDF2 (FRITZ!OS 7.24+) and MD5 challenges.
+func challengeResponse(challenge string, password string) (string, error) {
+	if strings.HasPrefix(challenge, "2$") {
+		return pbkdf2Response(challenge, password)
+	}
+	return md5Response(challenge, password), nil
+}
+
+// pbkdf2Response solves challenges of the form 2$<iter1>$<salt1>$<iter2>$<salt2>.
+func pbkdf2Response(challenge string, password string) (string, error) {
+	parts := strings.Split(challenge, "$")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("invalid PBKDF2 challenge: %s", challenge)
+	}
+
+	iter1, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid PBKDF2 challenge: %w", err)
+	}
+	salt1, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid PBKDF2 challenge: %w", err)
+	}
+	iter2, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid PBKDF2 challenge: %w", err)
+	}
+	salt2, err := hex.DecodeString(parts[4])
+	if err != nil {
+		return "", fmt.Errorf("invalid PBKDF2 challenge: %w", err)
+	}
+
+	hash1 := pbkdf2.Key([]byte(password), salt1, iter1, sha256.Size, sha256.New)
+	hash2 := pbkdf2.Key(hash1, salt2, iter2, sha256.Size, sha256.New)
+
+	return parts[4] + "$" + hex.EncodeToString(hash2), nil
+}
+
+// md5Response solves the legacy MD5 challenge: <challenge>-md5(utf16le(<challenge>-<password>)).
+// Characters outside of latin-1 are replaced by a dot.
+func md5Response(challenge string, password string) string {
+	var buf []byte
+	for _, r := range utf16.Encode([]rune(challenge + "-" + password)) {
+		if r > 255 {
+			r = '.'
+		}
+		buf = append(buf, byte(r), byte(r>>8))
+	}
+
+	sum := md5.Sum(buf)
+	return challenge + "-" + hex.EncodeToString(sum[:])
+}
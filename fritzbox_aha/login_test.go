@@ -0,0 +1,132 @@
+package fritzbox_aha
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// examples from the AVM technical note "Session IDs im FRITZ!Box Webinterface"
+func TestChallengeResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		password  string
+		want      string
+	}{
+		{"md5", "1234567z", "äbc", "1234567z-9e224a41eeefa284df7bb0f26c2913e2"},
+		{"pbkdf2", "2$10000$5A1711$2000$5A1722", "1example!",
+			"5A1722$1798a1672bca7c6463d6b245f82b53703b0f50813401b03e4045a5861e689adb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := challengeResponse(tt.challenge, tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("challengeResponse(%q) = %s, want %s", tt.challenge, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChallengeResponseInvalid(t *testing.T) {
+	for _, challenge := range []string{"2$10000$5A1711$2000", "2$x$5A1711$2000$5A1722", "2$10000$xyz$2000$5A1722"} {
+		if _, err := challengeResponse(challenge, "secret"); err == nil {
+			t.Errorf("challengeResponse(%q): no error", challenge)
+		}
+	}
+}
+
+const testChallenge = "2$10000$5A1711$2000$5A1722"
+
+// loginServer is a FRITZ!Box web interface with a single user. It issues one session id per login.
+type loginServer struct {
+	*httptest.Server
+	username string
+	password string
+	logins   int
+	sid      string
+}
+
+func newLoginServer(t *testing.T, username string, password string) *loginServer {
+	s := &loginServer{username: username, password: password}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login_sid.lua":
+			s.handleLogin(t, w, r)
+		case "/webservices/homeautoswitch.lua":
+			if s.sid == "" || r.URL.Query().Get("sid") != s.sid {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = fmt.Fprint(w, `<devicelist version="1"><device identifier="08761 0000434" id="17"><present>1</present><name>Lamp</name></device></devicelist>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *loginServer) handleLogin(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		_, _ = fmt.Fprintf(w, "<SessionInfo><SID>%s</SID><Challenge>%s</Challenge><BlockTime>0</BlockTime></SessionInfo>", invalidSID, testChallenge)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		t.Error(err)
+	}
+	want, _ := challengeResponse(testChallenge, s.password)
+	sid := invalidSID
+	if r.PostForm.Get("username") == s.username && r.PostForm.Get("response") == want {
+		s.logins++
+		s.sid = fmt.Sprintf("%016x", s.logins)
+		sid = s.sid
+	}
+	_, _ = fmt.Fprintf(w, "<SessionInfo><SID>%s</SID><Challenge>%s</Challenge><BlockTime>0</BlockTime></SessionInfo>", sid, testChallenge)
+}
+
+func TestLogin(t *testing.T) {
+	srv := newLoginServer(t, "user", "secret")
+	c := NewClient(srv.URL, "user", "secret", srv.Client())
+
+	devices, err := c.DeviceList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Name != "Lamp" {
+		t.Errorf("got devices %v, want Lamp", devices)
+	}
+
+	// the session is reused
+	if _, err := c.DeviceList(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.logins != 1 {
+		t.Errorf("%d logins, want 1", srv.logins)
+	}
+
+	// an expired session is renewed
+	srv.sid = "expired"
+	if _, err := c.DeviceList(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.logins != 2 {
+		t.Errorf("%d logins after the session expired, want 2", srv.logins)
+	}
+}
+
+func TestLoginFailed(t *testing.T) {
+	srv := newLoginServer(t, "user", "secret")
+	c := NewClient(srv.URL, "user", "wrong", srv.Client())
+
+	_, err := c.DeviceList()
+	if !errors.Is(err, ErrLoginFailed) {
+		t.Errorf("got error %v, want ErrLoginFailed", err)
+	}
+}
@@ -0,0 +1,91 @@
+package fritzbox_callmonitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EventType string
+
+const (
+	Ring       EventType = "RING"       // incoming call
+	Call       EventType = "CALL"       // outgoing call
+	Connect    EventType = "CONNECT"    // call is answered
+	Disconnect EventType = "DISCONNECT" // call is finished
+)
+
+const timeLayout = "02.01.06 15:04:05"
+
+// Event is a line of the call monitor.
+//
+//	RING:       date;RING;id;caller;callee;line;
+//	CALL:       date;CALL;id;extension;caller;callee;line;
+//	CONNECT:    date;CONNECT;id;extension;number;
+//	DISCONNECT: date;DISCONNECT;id;duration;
+type Event struct {
+	Time         time.Time
+	Type         EventType
+	ConnectionId string // identifies the call across events
+
+	Extension string        // internal extension; CALL and CONNECT only
+	Caller    string        // calling number; RING and CALL only
+	Callee    string        // called number; RING and CALL only
+	Number    string        // remote number; CONNECT only
+	Line      string        // SIP account (e.g. SIP0); RING and CALL only
+	Duration  time.Duration // duration of the call; DISCONNECT only
+}
+
+// ParseEvent parses a line of the call monitor. The time is interpreted in the location loc.
+func ParseEvent(line string, loc *time.Location) (Event, error) {
+	fields := strings.Split(strings.TrimSpace(line), ";")
+	if len(fields) < 4 {
+		return Event{}, fmt.Errorf("invalid call monitor line: %q", line)
+	}
+
+	t, err := time.ParseInLocation(timeLayout, fields[0], loc)
+	if err != nil {
+		return Event{}, fmt.Errorf("invalid call monitor line: %q: %w", line, err)
+	}
+
+	ev := Event{
+		Time:         t,
+		Type:         EventType(fields[1]),
+		ConnectionId: fields[2],
+	}
+
+	switch ev.Type {
+	case Ring:
+		if len(fields) < 6 {
+			return Event{}, fmt.Errorf("invalid call monitor line: %q", line)
+		}
+		ev.Caller = fields[3]
+		ev.Callee = fields[4]
+		ev.Line = fields[5]
+	case Call:
+		if len(fields) < 7 {
+			return Event{}, fmt.Errorf("invalid call monitor line: %q", line)
+		}
+		ev.Extension = fields[3]
+		ev.Caller = fields[4]
+		ev.Callee = fields[5]
+		ev.Line = fields[6]
+	case Connect:
+		if len(fields) < 5 {
+			return Event{}, fmt.Errorf("invalid call monitor line: %q", line)
+		}
+		ev.Extension = fields[3]
+		ev.Number = fields[4]
+	case Disconnect:
+		seconds, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return Event{}, fmt.Errorf("invalid call monitor line: %q: %w", line, err)
+		}
+		ev.Duration = time.Duration(seconds) * time.Second
+	default:
+		return Event{}, fmt.Errorf("unknown call monitor event: %q", line)
+	}
+
+	return ev, nil
+}
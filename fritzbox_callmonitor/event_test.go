@@ -0,0 +1,69 @@
+package fritzbox_callmonitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEvent(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	at := time.Date(2024, 3, 5, 18, 30, 15, 0, loc)
+
+	tests := []struct {
+		name string
+		line string
+		want Event
+		err  bool
+	}{
+		{
+			name: "ring",
+			line: "05.03.24 18:30:15;RING;0;0301234567;987654;SIP0;\r\n",
+			want: Event{Time: at, Type: Ring, ConnectionId: "0", Caller: "0301234567", Callee: "987654", Line: "SIP0"},
+		},
+		{
+			name: "call",
+			line: "05.03.24 18:30:15;CALL;1;10;987654;0301234567;SIP1;",
+			want: Event{Time: at, Type: Call, ConnectionId: "1", Extension: "10", Caller: "987654", Callee: "0301234567", Line: "SIP1"},
+		},
+		{
+			name: "connect",
+			line: "05.03.24 18:30:15;CONNECT;0;11;0301234567;",
+			want: Event{Time: at, Type: Connect, ConnectionId: "0", Extension: "11", Number: "0301234567"},
+		},
+		{
+			name: "disconnect",
+			line: "05.03.24 18:30:15;DISCONNECT;0;125;",
+			want: Event{Time: at, Type: Disconnect, ConnectionId: "0", Duration: 125 * time.Second},
+		},
+		{name: "empty", line: "", err: true},
+		{name: "too few fields", line: "05.03.24 18:30:15;RING;", err: true},
+		{name: "invalid time", line: "2024-03-05 18:30:15;DISCONNECT;0;125;", err: true},
+		{name: "unknown type", line: "05.03.24 18:30:15;HOLD;0;1;", err: true},
+		{name: "short ring", line: "05.03.24 18:30:15;RING;0;0301234567;", err: true},
+		{name: "short call", line: "05.03.24 18:30:15;CALL;1;10;987654;", err: true},
+		{name: "short connect", line: "05.03.24 18:30:15;CONNECT;0;11", err: true},
+		{name: "invalid duration", line: "05.03.24 18:30:15;DISCONNECT;0;abc;", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEvent(tt.line, loc)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("time: got %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time = tt.want.Time
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package fritzbox_callmonitor reads call events from the call monitor of Fritz!Box devices.
+//
+// The call monitor has to be enabled by dialing #96*5* on a connected telephone.
+package fritzbox_callmonitor
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultPort of the call monitor
+const DefaultPort = 1012
+
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 1 * time.Minute
+	keepAlive         = 30 * time.Second
+)
+
+// Monitor keeps a connection to the call monitor open and reconnects if it is lost.
+type Monitor struct {
+	Address  string         // host:port of the call monitor
+	Location *time.Location // time zone of the FRITZ!Box; time.Local if nil
+
+	OnEvent      func(Event)          // called for every event
+	OnConnection func(connected bool) // called when the connection is established or lost; optional
+	OnError      func(err error)      // called for connection and parse errors; optional
+}
+
+// Run connects to the call monitor and handles events. It never returns.
+func (m *Monitor) Run() {
+	delay := minReconnectDelay
+	for {
+		start := time.Now()
+		err := m.read()
+		m.error(err)
+
+		if time.Since(start) > maxReconnectDelay {
+			// connection was up for some time
+			delay = minReconnectDelay
+		}
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// read handles events of a single connection until the connection fails.
+func (m *Monitor) read() error {
+	dialer := net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: keepAlive,
+	}
+	conn, err := dialer.Dial("tcp", m.Address)
+	if err != nil {
+		return fmt.Errorf("cannot connect to call monitor: %w", err)
+	}
+	defer closeIgnoringError(conn)
+
+	m.connection(true)
+	defer m.connection(false)
+
+	loc := m.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		ev, err := ParseEvent(scanner.Text(), loc)
+		if err != nil {
+			m.error(err)
+			continue
+		}
+		m.OnEvent(ev)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("call monitor connection lost: %w", err)
+	}
+	return fmt.Errorf("call monitor connection closed")
+}
+
+func (m *Monitor) connection(connected bool) {
+	if m.OnConnection != nil {
+		m.OnConnection(connected)
+	}
+}
+
+func (m *Monitor) error(err error) {
+	if m.OnError != nil {
+		m.OnError(err)
+	}
+}
+
+// closeIgnoringError closes c an ignores errors
+func closeIgnoringError(c net.Conn) {
+	_ = c.Close()
+}
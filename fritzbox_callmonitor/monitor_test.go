@@ -0,0 +1,100 @@
+package fritzbox_callmonitor
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeIgnoringListener(ln)
+
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	events := make(chan Event, 10)
+	connected := make(chan bool, 10)
+	m := &Monitor{
+		Address:      ln.Addr().String(),
+		Location:     time.UTC,
+		OnEvent:      func(ev Event) { events <- ev },
+		OnConnection: func(c bool) { connected <- c },
+	}
+	go m.Run()
+
+	conn := accept(t, conns)
+	expectConnection(t, connected, true)
+
+	_, err = conn.Write([]byte("invalid line\n05.03.24 18:30:15;RING;0;0301234567;987654;SIP0;\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != Ring || ev.Caller != "0301234567" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+
+	// the connection is lost and established again
+	closeIgnoringError(conn)
+	expectConnection(t, connected, false)
+
+	conn = accept(t, conns)
+	defer closeIgnoringError(conn)
+	expectConnection(t, connected, true)
+
+	_, err = conn.Write([]byte("05.03.24 18:31:00;DISCONNECT;0;0;\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != Disconnect {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after reconnect")
+	}
+}
+
+func accept(t *testing.T, conns chan net.Conn) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor did not connect")
+		return nil
+	}
+}
+
+func expectConnection(t *testing.T, ch chan bool, want bool) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Fatalf("OnConnection(%v), want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnConnection(%v) not called", want)
+	}
+}
+
+func closeIgnoringListener(ln net.Listener) {
+	_ = ln.Close()
+}
@@ -0,0 +1,163 @@
+// Package fritzbox_tr064 provides typed clients for services of Fritz!Box devices.
+//
+// The clients are generated from recorded service descriptions in scpd/ and use the dynamic API of
+// fritzbox_upnp:
+//
+//	root, err := fritzbox_upnp.LoadServiceRoot(params, fritzbox_upnp.IGDServiceDescriptor)
+//	wan, err := fritzbox_tr064.NewWANCommonInterfaceConfig(root)
+//	infos, err := wan.GetAddonInfos(ctx)
+//
+// To add a service record its description, add it to scpd/services.yaml and run go generate.
+package fritzbox_tr064
+
+//go:generate go run ./internal/gen -services scpd/services.yaml -out .
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+var (
+	ErrServiceNotFound = errors.New("service not found")
+	ErrActionNotFound  = errors.New("action not found")
+	ErrInvalidValue    = errors.New("invalid value")
+)
+
+// client is embedded in all typed clients.
+type client struct {
+	service *upnp.Service
+}
+
+// Service returns the dynamic service of the client.
+func (c client) Service() *upnp.Service {
+	return c.service
+}
+
+func lookupService(root *upnp.Root, serviceType string) (*upnp.Service, error) {
+	s, ok := root.Services[serviceType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, serviceType)
+	}
+	return s, nil
+}
+
+func (c client) call(ctx context.Context, name string, args map[string]string) (result, error) {
+	action, ok := c.service.Actions[name]
+	if !ok {
+		return result{}, fmt.Errorf("%w: %s", ErrActionNotFound, name)
+	}
+
+	res, err := action.CallContext(ctx, args)
+	if err != nil {
+		return result{}, err
+	}
+	return result{action: action, res: res}, nil
+}
+
+// result gives typed access to the output arguments of a call.
+// Missing arguments return the zero value. Values that the device reported in a form that does not match the
+// data type of the argument (kept as string by fritzbox_upnp) return ErrInvalidValue.
+type result struct {
+	action *upnp.Action
+	res    upnp.Result
+}
+
+// typed returns the value of an output argument as T.
+func typed[T any](r result, argument string) (T, error) {
+	var zero T
+	val, ok := r.action.Value(r.res, argument)
+	if !ok || val == nil {
+		return zero, nil
+	}
+	res, ok := val.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s of %s: %v", ErrInvalidValue, argument, r.action.Name, val)
+	}
+	return res, nil
+}
+
+// string returns the value of a string argument. Values of all other data types can be read as string if they
+// could not be converted, so a string never fails.
+func (r result) string(argument string) string {
+	val, _ := r.action.Value(r.res, argument)
+	s, _ := val.(string)
+	return s
+}
+
+func (r result) uint64(argument string) (uint64, error) {
+	return typed[uint64](r, argument)
+}
+
+func (r result) int64(argument string) (int64, error) {
+	return typed[int64](r, argument)
+}
+
+func (r result) bool(argument string) (bool, error) {
+	return typed[bool](r, argument)
+}
+
+func (r result) float64(argument string) (float64, error) {
+	return typed[float64](r, argument)
+}
+
+func (r result) time(argument string) (time.Time, error) {
+	return typed[time.Time](r, argument)
+}
+
+func (r result) bytes(argument string) ([]byte, error) {
+	return typed[[]byte](r, argument)
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func formatBool(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatDate(v time.Time) string {
+	return v.Format(upnp.DateLayout)
+}
+
+func formatDateTime(v time.Time) string {
+	return v.Format(upnp.DateTimeLayout)
+}
+
+func formatDateTimeTZ(v time.Time) string {
+	return v.Format(upnp.DateTimeTZLayout)
+}
+
+func formatTime(v time.Time) string {
+	return v.Format(upnp.TimeLayout)
+}
+
+func formatTimeTZ(v time.Time) string {
+	return v.Format(upnp.TimeTZLayout)
+}
+
+func formatBase64(v []byte) string {
+	return base64.StdEncoding.EncodeToString(v)
+}
+
+func formatHex(v []byte) string {
+	return hex.EncodeToString(v)
+}
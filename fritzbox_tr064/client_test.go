@@ -0,0 +1,38 @@
+package fritzbox_tr064
+
+import (
+	"errors"
+	"testing"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+func TestResultInvalidValue(t *testing.T) {
+	upTime := &upnp.StateVariable{Name: "UpTime", DataType: "ui4"}
+	action := &upnp.Action{
+		Name: "GetInfo",
+		ArgumentMap: map[string]*upnp.Argument{
+			"NewUpTime": {Name: "NewUpTime", Direction: "out", StateVariable: upTime},
+		},
+	}
+
+	r := result{action: action, res: upnp.Result{"UpTime": uint64(4711)}}
+	if got, err := r.uint64("NewUpTime"); err != nil || got != 4711 {
+		t.Errorf("got %d, %v; want 4711", got, err)
+	}
+
+	// values that cannot be converted are kept as string by fritzbox_upnp
+	r = result{action: action, res: upnp.Result{"UpTime": "N/A"}}
+	if _, err := r.uint64("NewUpTime"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+	if got := r.string("NewUpTime"); got != "N/A" {
+		t.Errorf("string: got %q", got)
+	}
+
+	// missing arguments are the zero value
+	r = result{action: action, res: upnp.Result{}}
+	if got, err := r.uint64("NewUpTime"); err != nil || got != 0 {
+		t.Errorf("missing: got %d, %v", got, err)
+	}
+}
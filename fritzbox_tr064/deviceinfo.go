@@ -0,0 +1,126 @@
+// Code generated by fritzbox_tr064/internal/gen from scpd/deviceinfoSCPD.xml. DO NOT EDIT.
+
+package fritzbox_tr064
+
+import (
+	"context"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// DeviceInfoType is the service type of DeviceInfo.
+const DeviceInfoType = "urn:dslforum-org:service:DeviceInfo:1"
+
+// DeviceInfo is a typed client for the service urn:dslforum-org:service:DeviceInfo:1.
+type DeviceInfo struct {
+	client
+}
+
+// NewDeviceInfo returns the client for the first service of the type in root.
+func NewDeviceInfo(root *upnp.Root) (*DeviceInfo, error) {
+	s, err := lookupService(root, DeviceInfoType)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceInfo{client{s}}, nil
+}
+
+// DeviceInfoInfo is the result of DeviceInfo.GetInfo.
+type DeviceInfoInfo struct {
+	ManufacturerName string // NewManufacturerName (string)
+	ManufacturerOUI  string // NewManufacturerOUI (string)
+	ModelName        string // NewModelName (string)
+	Description      string // NewDescription (string)
+	ProductClass     string // NewProductClass (string)
+	SerialNumber     string // NewSerialNumber (string)
+	SoftwareVersion  string // NewSoftwareVersion (string)
+	HardwareVersion  string // NewHardwareVersion (string)
+	SpecVersion      string // NewSpecVersion (string)
+	ProvisioningCode string // NewProvisioningCode (string)
+	UpTime           uint64 // NewUpTime (ui4)
+	DeviceLog        string // NewDeviceLog (string)
+}
+
+// GetInfo calls the action GetInfo.
+func (s *DeviceInfo) GetInfo(ctx context.Context) (DeviceInfoInfo, error) {
+	var out DeviceInfoInfo
+	r, err := s.call(ctx, "GetInfo", nil)
+	if err != nil {
+		return out, err
+	}
+	out.ManufacturerName = r.string("NewManufacturerName")
+	out.ManufacturerOUI = r.string("NewManufacturerOUI")
+	out.ModelName = r.string("NewModelName")
+	out.Description = r.string("NewDescription")
+	out.ProductClass = r.string("NewProductClass")
+	out.SerialNumber = r.string("NewSerialNumber")
+	out.SoftwareVersion = r.string("NewSoftwareVersion")
+	out.HardwareVersion = r.string("NewHardwareVersion")
+	out.SpecVersion = r.string("NewSpecVersion")
+	out.ProvisioningCode = r.string("NewProvisioningCode")
+	out.UpTime, err = r.uint64("NewUpTime")
+	if err != nil {
+		return out, err
+	}
+	out.DeviceLog = r.string("NewDeviceLog")
+	return out, nil
+}
+
+// SetProvisioningCode calls the action SetProvisioningCode.
+func (s *DeviceInfo) SetProvisioningCode(ctx context.Context, provisioningCode string) error {
+	_, err := s.call(ctx, "SetProvisioningCode", map[string]string{
+		"NewProvisioningCode": provisioningCode,
+	})
+	return err
+}
+
+// DeviceInfoDeviceLog is the result of DeviceInfo.GetDeviceLog.
+type DeviceInfoDeviceLog struct {
+	DeviceLog string // NewDeviceLog (string)
+}
+
+// GetDeviceLog calls the action GetDeviceLog.
+func (s *DeviceInfo) GetDeviceLog(ctx context.Context) (DeviceInfoDeviceLog, error) {
+	var out DeviceInfoDeviceLog
+	r, err := s.call(ctx, "GetDeviceLog", nil)
+	if err != nil {
+		return out, err
+	}
+	out.DeviceLog = r.string("NewDeviceLog")
+	return out, nil
+}
+
+// DeviceInfoSecurityPort is the result of DeviceInfo.GetSecurityPort.
+type DeviceInfoSecurityPort struct {
+	SecurityPort uint64 // NewSecurityPort (ui2)
+}
+
+// GetSecurityPort calls the action GetSecurityPort.
+func (s *DeviceInfo) GetSecurityPort(ctx context.Context) (DeviceInfoSecurityPort, error) {
+	var out DeviceInfoSecurityPort
+	r, err := s.call(ctx, "GetSecurityPort", nil)
+	if err != nil {
+		return out, err
+	}
+	out.SecurityPort, err = r.uint64("NewSecurityPort")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// DeviceInfoAVMDeviceLogPath is the result of DeviceInfo.AVMGetDeviceLogPath.
+type DeviceInfoAVMDeviceLogPath struct {
+	DeviceLogPath string // NewDeviceLogPath (string)
+}
+
+// AVMGetDeviceLogPath calls the action X_AVM-DE_GetDeviceLogPath.
+func (s *DeviceInfo) AVMGetDeviceLogPath(ctx context.Context) (DeviceInfoAVMDeviceLogPath, error) {
+	var out DeviceInfoAVMDeviceLogPath
+	r, err := s.call(ctx, "X_AVM-DE_GetDeviceLogPath", nil)
+	if err != nil {
+		return out, err
+	}
+	out.DeviceLogPath = r.string("NewDeviceLogPath")
+	return out, nil
+}
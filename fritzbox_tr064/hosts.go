@@ -0,0 +1,167 @@
+// Code generated by fritzbox_tr064/internal/gen from scpd/hostsSCPD.xml. DO NOT EDIT.
+
+package fritzbox_tr064
+
+import (
+	"context"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// HostsType is the service type of Hosts.
+const HostsType = "urn:dslforum-org:service:Hosts:1"
+
+// Hosts is a typed client for the service urn:dslforum-org:service:Hosts:1.
+type Hosts struct {
+	client
+}
+
+// NewHosts returns the client for the first service of the type in root.
+func NewHosts(root *upnp.Root) (*Hosts, error) {
+	s, err := lookupService(root, HostsType)
+	if err != nil {
+		return nil, err
+	}
+	return &Hosts{client{s}}, nil
+}
+
+// HostsHostNumberOfEntries is the result of Hosts.GetHostNumberOfEntries.
+type HostsHostNumberOfEntries struct {
+	HostNumberOfEntries uint64 // NewHostNumberOfEntries (ui2)
+}
+
+// GetHostNumberOfEntries calls the action GetHostNumberOfEntries.
+func (s *Hosts) GetHostNumberOfEntries(ctx context.Context) (HostsHostNumberOfEntries, error) {
+	var out HostsHostNumberOfEntries
+	r, err := s.call(ctx, "GetHostNumberOfEntries", nil)
+	if err != nil {
+		return out, err
+	}
+	out.HostNumberOfEntries, err = r.uint64("NewHostNumberOfEntries")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// HostsSpecificHostEntry is the result of Hosts.GetSpecificHostEntry.
+type HostsSpecificHostEntry struct {
+	IPAddress          string // NewIPAddress (string)
+	AddressSource      string // NewAddressSource (string)
+	LeaseTimeRemaining int64  // NewLeaseTimeRemaining (i4)
+	InterfaceType      string // NewInterfaceType (string)
+	Active             bool   // NewActive (boolean)
+	HostName           string // NewHostName (string)
+}
+
+// GetSpecificHostEntry calls the action GetSpecificHostEntry.
+func (s *Hosts) GetSpecificHostEntry(ctx context.Context, macAddress string) (HostsSpecificHostEntry, error) {
+	var out HostsSpecificHostEntry
+	r, err := s.call(ctx, "GetSpecificHostEntry", map[string]string{
+		"NewMACAddress": macAddress,
+	})
+	if err != nil {
+		return out, err
+	}
+	out.IPAddress = r.string("NewIPAddress")
+	out.AddressSource = r.string("NewAddressSource")
+	out.LeaseTimeRemaining, err = r.int64("NewLeaseTimeRemaining")
+	if err != nil {
+		return out, err
+	}
+	out.InterfaceType = r.string("NewInterfaceType")
+	out.Active, err = r.bool("NewActive")
+	if err != nil {
+		return out, err
+	}
+	out.HostName = r.string("NewHostName")
+	return out, nil
+}
+
+// HostsGenericHostEntry is the result of Hosts.GetGenericHostEntry.
+type HostsGenericHostEntry struct {
+	IPAddress          string // NewIPAddress (string)
+	AddressSource      string // NewAddressSource (string)
+	LeaseTimeRemaining int64  // NewLeaseTimeRemaining (i4)
+	MACAddress         string // NewMACAddress (string)
+	InterfaceType      string // NewInterfaceType (string)
+	Active             bool   // NewActive (boolean)
+	HostName           string // NewHostName (string)
+}
+
+// GetGenericHostEntry calls the action GetGenericHostEntry.
+func (s *Hosts) GetGenericHostEntry(ctx context.Context, index uint64) (HostsGenericHostEntry, error) {
+	var out HostsGenericHostEntry
+	r, err := s.call(ctx, "GetGenericHostEntry", map[string]string{
+		"NewIndex": formatUint(index),
+	})
+	if err != nil {
+		return out, err
+	}
+	out.IPAddress = r.string("NewIPAddress")
+	out.AddressSource = r.string("NewAddressSource")
+	out.LeaseTimeRemaining, err = r.int64("NewLeaseTimeRemaining")
+	if err != nil {
+		return out, err
+	}
+	out.MACAddress = r.string("NewMACAddress")
+	out.InterfaceType = r.string("NewInterfaceType")
+	out.Active, err = r.bool("NewActive")
+	if err != nil {
+		return out, err
+	}
+	out.HostName = r.string("NewHostName")
+	return out, nil
+}
+
+// HostsAVMChangeCounter is the result of Hosts.AVMGetChangeCounter.
+type HostsAVMChangeCounter struct {
+	AVMGetChangeCounter uint64 // NewX_AVM-DE_GetChangeCounter (ui4)
+}
+
+// AVMGetChangeCounter calls the action X_AVM-DE_GetChangeCounter.
+func (s *Hosts) AVMGetChangeCounter(ctx context.Context) (HostsAVMChangeCounter, error) {
+	var out HostsAVMChangeCounter
+	r, err := s.call(ctx, "X_AVM-DE_GetChangeCounter", nil)
+	if err != nil {
+		return out, err
+	}
+	out.AVMGetChangeCounter, err = r.uint64("NewX_AVM-DE_GetChangeCounter")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// AVMSetHostNameByMACAddress calls the action X_AVM-DE_SetHostNameByMACAddress.
+func (s *Hosts) AVMSetHostNameByMACAddress(ctx context.Context, macAddress string, hostName string) error {
+	_, err := s.call(ctx, "X_AVM-DE_SetHostNameByMACAddress", map[string]string{
+		"NewMACAddress": macAddress,
+		"NewHostName":   hostName,
+	})
+	return err
+}
+
+// HostsAVMHostListPath is the result of Hosts.AVMGetHostListPath.
+type HostsAVMHostListPath struct {
+	AVMHostListPath string // NewX_AVM-DE_HostListPath (string)
+}
+
+// AVMGetHostListPath calls the action X_AVM-DE_GetHostListPath.
+func (s *Hosts) AVMGetHostListPath(ctx context.Context) (HostsAVMHostListPath, error) {
+	var out HostsAVMHostListPath
+	r, err := s.call(ctx, "X_AVM-DE_GetHostListPath", nil)
+	if err != nil {
+		return out, err
+	}
+	out.AVMHostListPath = r.string("NewX_AVM-DE_HostListPath")
+	return out, nil
+}
+
+// AVMWakeOnLANByMACAddress calls the action X_AVM-DE_WakeOnLANByMACAddress.
+func (s *Hosts) AVMWakeOnLANByMACAddress(ctx context.Context, macAddress string) error {
+	_, err := s.call(ctx, "X_AVM-DE_WakeOnLANByMACAddress", map[string]string{
+		"NewMACAddress": macAddress,
+	})
+	return err
+}
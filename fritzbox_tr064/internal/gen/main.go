@@ -0,0 +1,340 @@
+// Command gen generates typed clients for services from recorded service descriptions (SCPD).
+//
+//	go run ./internal/gen -services scpd/services.yaml -out .
+//
+// For every service in the services file a file <name>.go is written with a client type, a constructor,
+// a result struct for every action with output arguments and a method for every action.
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	"gopkg.in/yaml.v3"
+)
+
+// serviceSpec is an entry of the services file
+type serviceSpec struct {
+	Name string // name of the Go type
+	Type string // service type
+	File string // recorded SCPD, relative to the services file
+}
+
+type scpdRoot struct {
+	Actions        []*upnp.Action        `xml:"actionList>action"`
+	StateVariables []*upnp.StateVariable `xml:"serviceStateTable>stateVariable"`
+}
+
+// goType describes how a data type of a state variable is mapped to Go
+type goType struct {
+	Name   string // Go type
+	Result string // method of result to read an output argument; all but string return a conversion error
+	Format string // function to format an input argument
+}
+
+var goTypes = map[string]goType{
+	"string":      {"string", "string", ""},
+	"char":        {"string", "string", ""},
+	"uri":         {"string", "string", ""},
+	"uuid":        {"string", "string", ""},
+	"boolean":     {"bool", "bool", "formatBool"},
+	"ui1":         {"uint64", "uint64", "formatUint"},
+	"ui2":         {"uint64", "uint64", "formatUint"},
+	"ui4":         {"uint64", "uint64", "formatUint"},
+	"ui8":         {"uint64", "uint64", "formatUint"},
+	"i1":          {"int64", "int64", "formatInt"},
+	"i2":          {"int64", "int64", "formatInt"},
+	"i4":          {"int64", "int64", "formatInt"},
+	"i8":          {"int64", "int64", "formatInt"},
+	"int":         {"int64", "int64", "formatInt"},
+	"r4":          {"float64", "float64", "formatFloat"},
+	"r8":          {"float64", "float64", "formatFloat"},
+	"number":      {"float64", "float64", "formatFloat"},
+	"fixed.14.4":  {"float64", "float64", "formatFloat"},
+	"float":       {"float64", "float64", "formatFloat"},
+	"date":        {"time.Time", "time", "formatDate"},
+	"dateTime":    {"time.Time", "time", "formatDateTime"},
+	"dateTime.tz": {"time.Time", "time", "formatDateTimeTZ"},
+	"time":        {"time.Time", "time", "formatTime"},
+	"time.tz":     {"time.Time", "time", "formatTimeTZ"},
+	"bin.base64":  {"[]byte", "bytes", "formatBase64"},
+	"bin.hex":     {"[]byte", "bytes", "formatHex"},
+}
+
+// unknown data types are kept as string by fritzbox_upnp
+var unknownType = goType{"string", "string", ""}
+
+type service struct {
+	serviceSpec
+	Source  string
+	Actions []*action
+	UseTime bool // generated code uses time.Time
+}
+
+type action struct {
+	Name    string // name of the action
+	Method  string // name of the Go method
+	Result  string // name of the result type; empty if the action has no output arguments
+	Inputs  []*argument
+	Outputs []*argument
+}
+
+type argument struct {
+	Name     string // name of the argument
+	Field    string // name of the struct field or parameter
+	DataType string
+	Go       goType
+}
+
+func main() {
+	servicesFile := flag.String("services", "scpd/services.yaml", "file with the services to generate")
+	outDir := flag.String("out", ".", "output directory")
+	flag.Parse()
+
+	err := run(*servicesFile, *outDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(servicesFile string, outDir string) error {
+	data, err := os.ReadFile(servicesFile)
+	if err != nil {
+		return err
+	}
+
+	var specs []serviceSpec
+	err = yaml.Unmarshal(data, &specs)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", servicesFile, err)
+	}
+
+	for _, spec := range specs {
+		source := filepath.Join(filepath.Dir(servicesFile), spec.File)
+		s, err := loadService(spec, source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.Name, err)
+		}
+
+		code, err := generate(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.Name, err)
+		}
+
+		out := filepath.Join(outDir, strings.ToLower(spec.Name)+".go")
+		err = os.WriteFile(out, code, 0644)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %d actions", out, len(s.Actions))
+	}
+	return nil
+}
+
+func loadService(spec serviceSpec, source string) (*service, error) {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var scpd scpdRoot
+	err = xml.Unmarshal(data, &scpd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", source, err)
+	}
+
+	vars := make(map[string]*upnp.StateVariable)
+	for _, v := range scpd.StateVariables {
+		vars[v.Name] = v
+	}
+
+	s := &service{
+		serviceSpec: spec,
+		Source:      filepath.ToSlash(source),
+	}
+
+	for _, a := range scpd.Actions {
+		act := &action{
+			Name:   a.Name,
+			Method: identifier(a.Name),
+		}
+
+		for _, arg := range a.Arguments {
+			v, ok := vars[arg.RelatedStateVariable]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown state variable %s", a.Name, arg.RelatedStateVariable)
+			}
+			t, ok := goTypes[v.DataType]
+			if !ok {
+				t = unknownType
+			}
+
+			if t.Name == "time.Time" {
+				s.UseTime = true
+			}
+
+			ga := &argument{
+				Name:     arg.Name,
+				Field:    identifier(strings.TrimPrefix(arg.Name, "New")),
+				DataType: v.DataType,
+				Go:       t,
+			}
+			if arg.Direction == "in" {
+				ga.Field = parameterName(ga.Field)
+				act.Inputs = append(act.Inputs, ga)
+			} else {
+				act.Outputs = append(act.Outputs, ga)
+			}
+		}
+
+		if len(act.Outputs) > 0 {
+			act.Result = spec.Name + resultName(act.Method)
+		}
+		s.Actions = append(s.Actions, act)
+	}
+	return s, nil
+}
+
+// identifier converts a name of the description to an exported Go identifier:
+// X_AVM-DE_GetChangeCounter -> AVMGetChangeCounter, Newmax_ds -> MaxDs
+func identifier(name string) string {
+	for _, prefix := range []string{"X_AVM-DE_", "X_AVM_DE_"} {
+		if strings.HasPrefix(name, prefix) {
+			name = "AVM" + name[len(prefix):]
+		}
+	}
+
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// resultName removes the Get prefix of a method name: GetAddonInfos -> AddonInfos, AVMGetOnlineMonitor -> AVMOnlineMonitor
+func resultName(method string) string {
+	if strings.HasPrefix(method, "AVMGet") {
+		return "AVM" + strings.TrimPrefix(method, "AVMGet")
+	}
+	return strings.TrimPrefix(method, "Get")
+}
+
+// parameterName converts an identifier to an unexported name: MACAddress -> macAddress, Index -> index
+func parameterName(id string) string {
+	runes := []rune(id)
+	i := 0
+	for i < len(runes) && unicode.IsUpper(runes[i]) {
+		i++
+	}
+	if i > 1 && i < len(runes) {
+		i-- // keep the first letter of the next word: MACAddress -> macAddress
+	}
+	name := strings.ToLower(string(runes[:i])) + string(runes[i:])
+
+	switch name {
+	case "type", "func", "var", "range", "map", "select", "default", "interface", "go", "chan":
+		name += "_"
+	}
+	return name
+}
+
+func generate(s *service) ([]byte, error) {
+	var buf bytes.Buffer
+	err := serviceTemplate.Execute(&buf, s)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cannot format generated code: %w\n%s", err, buf.Bytes())
+	}
+	return code, nil
+}
+
+var serviceTemplate = template.Must(template.New("service").Parse(`// Code generated by fritzbox_tr064/internal/gen from {{.Source}}. DO NOT EDIT.
+
+package fritzbox_tr064
+
+import (
+	"context"
+{{- if .UseTime}}
+	"time"
+{{- end}}
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// {{.Name}}Type is the service type of {{.Name}}.
+const {{.Name}}Type = "{{.Type}}"
+
+// {{.Name}} is a typed client for the service {{.Type}}.
+type {{.Name}} struct {
+	client
+}
+
+// New{{.Name}} returns the client for the first service of the type in root.
+func New{{.Name}}(root *upnp.Root) (*{{.Name}}, error) {
+	s, err := lookupService(root, {{.Name}}Type)
+	if err != nil {
+		return nil, err
+	}
+	return &{{.Name}}{client{s}}, nil
+}
+{{range $a := .Actions}}{{if $a.Result}}
+// {{$a.Result}} is the result of {{$.Name}}.{{$a.Method}}.
+type {{$a.Result}} struct {
+{{- range $a.Outputs}}
+	{{.Field}} {{.Go.Name}} // {{.Name}} ({{.DataType}})
+{{- end}}
+}
+{{end}}
+// {{$a.Method}} calls the action {{$a.Name}}.
+func (s *{{$.Name}}) {{$a.Method}}(ctx context.Context{{range $a.Inputs}}, {{.Field}} {{.Go.Name}}{{end}}) ({{if $a.Result}}{{$a.Result}}, {{end}}error) {
+	{{- if $a.Result}}
+	var out {{$a.Result}}
+	{{- end}}
+	{{if $a.Result}}r{{else}}_{{end}}, err := s.call(ctx, "{{$a.Name}}", {{if $a.Inputs}}map[string]string{
+	{{- range $a.Inputs}}
+		"{{.Name}}": {{if .Go.Format}}{{.Go.Format}}({{.Field}}){{else}}{{.Field}}{{end}},
+	{{- end}}
+	}{{else}}nil{{end}})
+	{{- if $a.Result}}
+	if err != nil {
+		return out, err
+	}
+	{{- range $a.Outputs}}
+	{{- if eq .Go.Result "string"}}
+	out.{{.Field}} = r.string("{{.Name}}")
+	{{- else}}
+	out.{{.Field}}, err = r.{{.Go.Result}}("{{.Name}}")
+	if err != nil {
+		return out, err
+	}
+	{{- end}}
+	{{- end}}
+	return out, nil
+	{{- else}}
+	return err
+	{{- end}}
+}
+{{end}}`))
@@ -0,0 +1,250 @@
+// Code generated by fritzbox_tr064/internal/gen from scpd/igdicfgSCPD.xml. DO NOT EDIT.
+
+package fritzbox_tr064
+
+import (
+	"context"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// WANCommonInterfaceConfigType is the service type of WANCommonInterfaceConfig.
+const WANCommonInterfaceConfigType = "urn:schemas-upnp-org:service:WANCommonInterfaceConfig:1"
+
+// WANCommonInterfaceConfig is a typed client for the service urn:schemas-upnp-org:service:WANCommonInterfaceConfig:1.
+type WANCommonInterfaceConfig struct {
+	client
+}
+
+// NewWANCommonInterfaceConfig returns the client for the first service of the type in root.
+func NewWANCommonInterfaceConfig(root *upnp.Root) (*WANCommonInterfaceConfig, error) {
+	s, err := lookupService(root, WANCommonInterfaceConfigType)
+	if err != nil {
+		return nil, err
+	}
+	return &WANCommonInterfaceConfig{client{s}}, nil
+}
+
+// WANCommonInterfaceConfigCommonLinkProperties is the result of WANCommonInterfaceConfig.GetCommonLinkProperties.
+type WANCommonInterfaceConfigCommonLinkProperties struct {
+	WANAccessType              string // NewWANAccessType (string)
+	Layer1UpstreamMaxBitRate   uint64 // NewLayer1UpstreamMaxBitRate (ui4)
+	Layer1DownstreamMaxBitRate uint64 // NewLayer1DownstreamMaxBitRate (ui4)
+	PhysicalLinkStatus         string // NewPhysicalLinkStatus (string)
+}
+
+// GetCommonLinkProperties calls the action GetCommonLinkProperties.
+func (s *WANCommonInterfaceConfig) GetCommonLinkProperties(ctx context.Context) (WANCommonInterfaceConfigCommonLinkProperties, error) {
+	var out WANCommonInterfaceConfigCommonLinkProperties
+	r, err := s.call(ctx, "GetCommonLinkProperties", nil)
+	if err != nil {
+		return out, err
+	}
+	out.WANAccessType = r.string("NewWANAccessType")
+	out.Layer1UpstreamMaxBitRate, err = r.uint64("NewLayer1UpstreamMaxBitRate")
+	if err != nil {
+		return out, err
+	}
+	out.Layer1DownstreamMaxBitRate, err = r.uint64("NewLayer1DownstreamMaxBitRate")
+	if err != nil {
+		return out, err
+	}
+	out.PhysicalLinkStatus = r.string("NewPhysicalLinkStatus")
+	return out, nil
+}
+
+// WANCommonInterfaceConfigTotalBytesSent is the result of WANCommonInterfaceConfig.GetTotalBytesSent.
+type WANCommonInterfaceConfigTotalBytesSent struct {
+	TotalBytesSent uint64 // NewTotalBytesSent (ui4)
+}
+
+// GetTotalBytesSent calls the action GetTotalBytesSent.
+func (s *WANCommonInterfaceConfig) GetTotalBytesSent(ctx context.Context) (WANCommonInterfaceConfigTotalBytesSent, error) {
+	var out WANCommonInterfaceConfigTotalBytesSent
+	r, err := s.call(ctx, "GetTotalBytesSent", nil)
+	if err != nil {
+		return out, err
+	}
+	out.TotalBytesSent, err = r.uint64("NewTotalBytesSent")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANCommonInterfaceConfigTotalBytesReceived is the result of WANCommonInterfaceConfig.GetTotalBytesReceived.
+type WANCommonInterfaceConfigTotalBytesReceived struct {
+	TotalBytesReceived uint64 // NewTotalBytesReceived (ui4)
+}
+
+// GetTotalBytesReceived calls the action GetTotalBytesReceived.
+func (s *WANCommonInterfaceConfig) GetTotalBytesReceived(ctx context.Context) (WANCommonInterfaceConfigTotalBytesReceived, error) {
+	var out WANCommonInterfaceConfigTotalBytesReceived
+	r, err := s.call(ctx, "GetTotalBytesReceived", nil)
+	if err != nil {
+		return out, err
+	}
+	out.TotalBytesReceived, err = r.uint64("NewTotalBytesReceived")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANCommonInterfaceConfigTotalPacketsSent is the result of WANCommonInterfaceConfig.GetTotalPacketsSent.
+type WANCommonInterfaceConfigTotalPacketsSent struct {
+	TotalPacketsSent uint64 // NewTotalPacketsSent (ui4)
+}
+
+// GetTotalPacketsSent calls the action GetTotalPacketsSent.
+func (s *WANCommonInterfaceConfig) GetTotalPacketsSent(ctx context.Context) (WANCommonInterfaceConfigTotalPacketsSent, error) {
+	var out WANCommonInterfaceConfigTotalPacketsSent
+	r, err := s.call(ctx, "GetTotalPacketsSent", nil)
+	if err != nil {
+		return out, err
+	}
+	out.TotalPacketsSent, err = r.uint64("NewTotalPacketsSent")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANCommonInterfaceConfigTotalPacketsReceived is the result of WANCommonInterfaceConfig.GetTotalPacketsReceived.
+type WANCommonInterfaceConfigTotalPacketsReceived struct {
+	TotalPacketsReceived uint64 // NewTotalPacketsReceived (ui4)
+}
+
+// GetTotalPacketsReceived calls the action GetTotalPacketsReceived.
+func (s *WANCommonInterfaceConfig) GetTotalPacketsReceived(ctx context.Context) (WANCommonInterfaceConfigTotalPacketsReceived, error) {
+	var out WANCommonInterfaceConfigTotalPacketsReceived
+	r, err := s.call(ctx, "GetTotalPacketsReceived", nil)
+	if err != nil {
+		return out, err
+	}
+	out.TotalPacketsReceived, err = r.uint64("NewTotalPacketsReceived")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANCommonInterfaceConfigAddonInfos is the result of WANCommonInterfaceConfig.GetAddonInfos.
+type WANCommonInterfaceConfigAddonInfos struct {
+	ByteSendRate            uint64 // NewByteSendRate (ui4)
+	ByteReceiveRate         uint64 // NewByteReceiveRate (ui4)
+	PacketSendRate          uint64 // NewPacketSendRate (ui4)
+	PacketReceiveRate       uint64 // NewPacketReceiveRate (ui4)
+	TotalBytesSent          uint64 // NewTotalBytesSent (ui4)
+	TotalBytesReceived      uint64 // NewTotalBytesReceived (ui4)
+	AutoDisconnectTime      uint64 // NewAutoDisconnectTime (ui4)
+	IdleDisconnectTime      uint64 // NewIdleDisconnectTime (ui4)
+	DNSServer1              string // NewDNSServer1 (string)
+	DNSServer2              string // NewDNSServer2 (string)
+	VoipDNSServer1          string // NewVoipDNSServer1 (string)
+	VoipDNSServer2          string // NewVoipDNSServer2 (string)
+	UpnpControlEnabled      bool   // NewUpnpControlEnabled (boolean)
+	RoutedBridgedModeBoth   uint64 // NewRoutedBridgedModeBoth (ui1)
+	AVMTotalBytesSent64     string // NewX_AVM_DE_TotalBytesSent64 (string)
+	AVMTotalBytesReceived64 string // NewX_AVM_DE_TotalBytesReceived64 (string)
+	AVMWANAccessType        string // NewX_AVM_DE_WANAccessType (string)
+}
+
+// GetAddonInfos calls the action GetAddonInfos.
+func (s *WANCommonInterfaceConfig) GetAddonInfos(ctx context.Context) (WANCommonInterfaceConfigAddonInfos, error) {
+	var out WANCommonInterfaceConfigAddonInfos
+	r, err := s.call(ctx, "GetAddonInfos", nil)
+	if err != nil {
+		return out, err
+	}
+	out.ByteSendRate, err = r.uint64("NewByteSendRate")
+	if err != nil {
+		return out, err
+	}
+	out.ByteReceiveRate, err = r.uint64("NewByteReceiveRate")
+	if err != nil {
+		return out, err
+	}
+	out.PacketSendRate, err = r.uint64("NewPacketSendRate")
+	if err != nil {
+		return out, err
+	}
+	out.PacketReceiveRate, err = r.uint64("NewPacketReceiveRate")
+	if err != nil {
+		return out, err
+	}
+	out.TotalBytesSent, err = r.uint64("NewTotalBytesSent")
+	if err != nil {
+		return out, err
+	}
+	out.TotalBytesReceived, err = r.uint64("NewTotalBytesReceived")
+	if err != nil {
+		return out, err
+	}
+	out.AutoDisconnectTime, err = r.uint64("NewAutoDisconnectTime")
+	if err != nil {
+		return out, err
+	}
+	out.IdleDisconnectTime, err = r.uint64("NewIdleDisconnectTime")
+	if err != nil {
+		return out, err
+	}
+	out.DNSServer1 = r.string("NewDNSServer1")
+	out.DNSServer2 = r.string("NewDNSServer2")
+	out.VoipDNSServer1 = r.string("NewVoipDNSServer1")
+	out.VoipDNSServer2 = r.string("NewVoipDNSServer2")
+	out.UpnpControlEnabled, err = r.bool("NewUpnpControlEnabled")
+	if err != nil {
+		return out, err
+	}
+	out.RoutedBridgedModeBoth, err = r.uint64("NewRoutedBridgedModeBoth")
+	if err != nil {
+		return out, err
+	}
+	out.AVMTotalBytesSent64 = r.string("NewX_AVM_DE_TotalBytesSent64")
+	out.AVMTotalBytesReceived64 = r.string("NewX_AVM_DE_TotalBytesReceived64")
+	out.AVMWANAccessType = r.string("NewX_AVM_DE_WANAccessType")
+	return out, nil
+}
+
+// WANCommonInterfaceConfigAVMDsliteStatus is the result of WANCommonInterfaceConfig.AVMGetDsliteStatus.
+type WANCommonInterfaceConfigAVMDsliteStatus struct {
+	AVMDsliteStatus bool // NewX_AVM_DE_DsliteStatus (boolean)
+}
+
+// AVMGetDsliteStatus calls the action X_AVM_DE_GetDsliteStatus.
+func (s *WANCommonInterfaceConfig) AVMGetDsliteStatus(ctx context.Context) (WANCommonInterfaceConfigAVMDsliteStatus, error) {
+	var out WANCommonInterfaceConfigAVMDsliteStatus
+	r, err := s.call(ctx, "X_AVM_DE_GetDsliteStatus", nil)
+	if err != nil {
+		return out, err
+	}
+	out.AVMDsliteStatus, err = r.bool("NewX_AVM_DE_DsliteStatus")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANCommonInterfaceConfigAVMIPTVInfos is the result of WANCommonInterfaceConfig.AVMGetIPTVInfos.
+type WANCommonInterfaceConfigAVMIPTVInfos struct {
+	AVMIPTVEnabled  bool   // NewX_AVM_DE_IPTV_Enabled (boolean)
+	AVMIPTVProvider string // NewX_AVM_DE_IPTV_Provider (string)
+	AVMIPTVURL      string // NewX_AVM_DE_IPTV_URL (string)
+}
+
+// AVMGetIPTVInfos calls the action X_AVM_DE_GetIPTVInfos.
+func (s *WANCommonInterfaceConfig) AVMGetIPTVInfos(ctx context.Context) (WANCommonInterfaceConfigAVMIPTVInfos, error) {
+	var out WANCommonInterfaceConfigAVMIPTVInfos
+	r, err := s.call(ctx, "X_AVM_DE_GetIPTVInfos", nil)
+	if err != nil {
+		return out, err
+	}
+	out.AVMIPTVEnabled, err = r.bool("NewX_AVM_DE_IPTV_Enabled")
+	if err != nil {
+		return out, err
+	}
+	out.AVMIPTVProvider = r.string("NewX_AVM_DE_IPTV_Provider")
+	out.AVMIPTVURL = r.string("NewX_AVM_DE_IPTV_URL")
+	return out, nil
+}
@@ -0,0 +1,235 @@
+// Code generated by fritzbox_tr064/internal/gen from scpd/igdconnSCPD.xml. DO NOT EDIT.
+
+package fritzbox_tr064
+
+import (
+	"context"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// WANIPConnectionType is the service type of WANIPConnection.
+const WANIPConnectionType = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+// WANIPConnection is a typed client for the service urn:schemas-upnp-org:service:WANIPConnection:1.
+type WANIPConnection struct {
+	client
+}
+
+// NewWANIPConnection returns the client for the first service of the type in root.
+func NewWANIPConnection(root *upnp.Root) (*WANIPConnection, error) {
+	s, err := lookupService(root, WANIPConnectionType)
+	if err != nil {
+		return nil, err
+	}
+	return &WANIPConnection{client{s}}, nil
+}
+
+// SetConnectionType calls the action SetConnectionType.
+func (s *WANIPConnection) SetConnectionType(ctx context.Context, connectionType string) error {
+	_, err := s.call(ctx, "SetConnectionType", map[string]string{
+		"NewConnectionType": connectionType,
+	})
+	return err
+}
+
+// WANIPConnectionConnectionTypeInfo is the result of WANIPConnection.GetConnectionTypeInfo.
+type WANIPConnectionConnectionTypeInfo struct {
+	ConnectionType          string // NewConnectionType (string)
+	PossibleConnectionTypes string // NewPossibleConnectionTypes (string)
+}
+
+// GetConnectionTypeInfo calls the action GetConnectionTypeInfo.
+func (s *WANIPConnection) GetConnectionTypeInfo(ctx context.Context) (WANIPConnectionConnectionTypeInfo, error) {
+	var out WANIPConnectionConnectionTypeInfo
+	r, err := s.call(ctx, "GetConnectionTypeInfo", nil)
+	if err != nil {
+		return out, err
+	}
+	out.ConnectionType = r.string("NewConnectionType")
+	out.PossibleConnectionTypes = r.string("NewPossibleConnectionTypes")
+	return out, nil
+}
+
+// RequestConnection calls the action RequestConnection.
+func (s *WANIPConnection) RequestConnection(ctx context.Context) error {
+	_, err := s.call(ctx, "RequestConnection", nil)
+	return err
+}
+
+// ForceTermination calls the action ForceTermination.
+func (s *WANIPConnection) ForceTermination(ctx context.Context) error {
+	_, err := s.call(ctx, "ForceTermination", nil)
+	return err
+}
+
+// WANIPConnectionStatusInfo is the result of WANIPConnection.GetStatusInfo.
+type WANIPConnectionStatusInfo struct {
+	ConnectionStatus    string // NewConnectionStatus (string)
+	LastConnectionError string // NewLastConnectionError (string)
+	Uptime              uint64 // NewUptime (ui4)
+}
+
+// GetStatusInfo calls the action GetStatusInfo.
+func (s *WANIPConnection) GetStatusInfo(ctx context.Context) (WANIPConnectionStatusInfo, error) {
+	var out WANIPConnectionStatusInfo
+	r, err := s.call(ctx, "GetStatusInfo", nil)
+	if err != nil {
+		return out, err
+	}
+	out.ConnectionStatus = r.string("NewConnectionStatus")
+	out.LastConnectionError = r.string("NewLastConnectionError")
+	out.Uptime, err = r.uint64("NewUptime")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANIPConnectionNATRSIPStatus is the result of WANIPConnection.GetNATRSIPStatus.
+type WANIPConnectionNATRSIPStatus struct {
+	RSIPAvailable bool // NewRSIPAvailable (boolean)
+	NATEnabled    bool // NewNATEnabled (boolean)
+}
+
+// GetNATRSIPStatus calls the action GetNATRSIPStatus.
+func (s *WANIPConnection) GetNATRSIPStatus(ctx context.Context) (WANIPConnectionNATRSIPStatus, error) {
+	var out WANIPConnectionNATRSIPStatus
+	r, err := s.call(ctx, "GetNATRSIPStatus", nil)
+	if err != nil {
+		return out, err
+	}
+	out.RSIPAvailable, err = r.bool("NewRSIPAvailable")
+	if err != nil {
+		return out, err
+	}
+	out.NATEnabled, err = r.bool("NewNATEnabled")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANIPConnectionExternalIPAddress is the result of WANIPConnection.GetExternalIPAddress.
+type WANIPConnectionExternalIPAddress struct {
+	ExternalIPAddress string // NewExternalIPAddress (string)
+}
+
+// GetExternalIPAddress calls the action GetExternalIPAddress.
+func (s *WANIPConnection) GetExternalIPAddress(ctx context.Context) (WANIPConnectionExternalIPAddress, error) {
+	var out WANIPConnectionExternalIPAddress
+	r, err := s.call(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return out, err
+	}
+	out.ExternalIPAddress = r.string("NewExternalIPAddress")
+	return out, nil
+}
+
+// WANIPConnectionAVMExternalIPv6Address is the result of WANIPConnection.AVMGetExternalIPv6Address.
+type WANIPConnectionAVMExternalIPv6Address struct {
+	ExternalIPv6Address string // NewExternalIPv6Address (string)
+	PrefixLength        uint64 // NewPrefixLength (ui1)
+	ValidLifetime       uint64 // NewValidLifetime (ui4)
+	PreferedLifetime    uint64 // NewPreferedLifetime (ui4)
+}
+
+// AVMGetExternalIPv6Address calls the action X_AVM_DE_GetExternalIPv6Address.
+func (s *WANIPConnection) AVMGetExternalIPv6Address(ctx context.Context) (WANIPConnectionAVMExternalIPv6Address, error) {
+	var out WANIPConnectionAVMExternalIPv6Address
+	r, err := s.call(ctx, "X_AVM_DE_GetExternalIPv6Address", nil)
+	if err != nil {
+		return out, err
+	}
+	out.ExternalIPv6Address = r.string("NewExternalIPv6Address")
+	out.PrefixLength, err = r.uint64("NewPrefixLength")
+	if err != nil {
+		return out, err
+	}
+	out.ValidLifetime, err = r.uint64("NewValidLifetime")
+	if err != nil {
+		return out, err
+	}
+	out.PreferedLifetime, err = r.uint64("NewPreferedLifetime")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANIPConnectionAVMIPv6Prefix is the result of WANIPConnection.AVMGetIPv6Prefix.
+type WANIPConnectionAVMIPv6Prefix struct {
+	IPv6Prefix       string // NewIPv6Prefix (string)
+	PrefixLength     uint64 // NewPrefixLength (ui1)
+	ValidLifetime    uint64 // NewValidLifetime (ui4)
+	PreferedLifetime uint64 // NewPreferedLifetime (ui4)
+}
+
+// AVMGetIPv6Prefix calls the action X_AVM_DE_GetIPv6Prefix.
+func (s *WANIPConnection) AVMGetIPv6Prefix(ctx context.Context) (WANIPConnectionAVMIPv6Prefix, error) {
+	var out WANIPConnectionAVMIPv6Prefix
+	r, err := s.call(ctx, "X_AVM_DE_GetIPv6Prefix", nil)
+	if err != nil {
+		return out, err
+	}
+	out.IPv6Prefix = r.string("NewIPv6Prefix")
+	out.PrefixLength, err = r.uint64("NewPrefixLength")
+	if err != nil {
+		return out, err
+	}
+	out.ValidLifetime, err = r.uint64("NewValidLifetime")
+	if err != nil {
+		return out, err
+	}
+	out.PreferedLifetime, err = r.uint64("NewPreferedLifetime")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// WANIPConnectionAVMDNSServer is the result of WANIPConnection.AVMGetDNSServer.
+type WANIPConnectionAVMDNSServer struct {
+	IPv4DNSServer1 string // NewIPv4DNSServer1 (string)
+	IPv4DNSServer2 string // NewIPv4DNSServer2 (string)
+}
+
+// AVMGetDNSServer calls the action X_AVM_DE_GetDNSServer.
+func (s *WANIPConnection) AVMGetDNSServer(ctx context.Context) (WANIPConnectionAVMDNSServer, error) {
+	var out WANIPConnectionAVMDNSServer
+	r, err := s.call(ctx, "X_AVM_DE_GetDNSServer", nil)
+	if err != nil {
+		return out, err
+	}
+	out.IPv4DNSServer1 = r.string("NewIPv4DNSServer1")
+	out.IPv4DNSServer2 = r.string("NewIPv4DNSServer2")
+	return out, nil
+}
+
+// WANIPConnectionAVMIPv6DNSServer is the result of WANIPConnection.AVMGetIPv6DNSServer.
+type WANIPConnectionAVMIPv6DNSServer struct {
+	IPv6DNSServer1 string // NewIPv6DNSServer1 (string)
+	ValidLifetime1 uint64 // NewValidLifetime1 (ui4)
+	IPv6DNSServer2 string // NewIPv6DNSServer2 (string)
+	ValidLifetime2 uint64 // NewValidLifetime2 (ui4)
+}
+
+// AVMGetIPv6DNSServer calls the action X_AVM_DE_GetIPv6DNSServer.
+func (s *WANIPConnection) AVMGetIPv6DNSServer(ctx context.Context) (WANIPConnectionAVMIPv6DNSServer, error) {
+	var out WANIPConnectionAVMIPv6DNSServer
+	r, err := s.call(ctx, "X_AVM_DE_GetIPv6DNSServer", nil)
+	if err != nil {
+		return out, err
+	}
+	out.IPv6DNSServer1 = r.string("NewIPv6DNSServer1")
+	out.ValidLifetime1, err = r.uint64("NewValidLifetime1")
+	if err != nil {
+		return out, err
+	}
+	out.IPv6DNSServer2 = r.string("NewIPv6DNSServer2")
+	out.ValidLifetime2, err = r.uint64("NewValidLifetime2")
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
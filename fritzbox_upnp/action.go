@@ -2,13 +2,18 @@ package fritzbox_upnp
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"strconv"
+	"regexp"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Action is an UPNP Action on a service
@@ -44,31 +49,135 @@ type StateVariable struct {
 	Name         string `xml:"name"`
 	DataType     string `xml:"dataType"`
 	DefaultValue string `xml:"defaultValue"`
+
+	AllowedValueList  []string           `xml:"allowedValueList>allowedValue"` // allowed values of a string variable; optional
+	AllowedValueRange *AllowedValueRange `xml:"allowedValueRange"`             // range of a numeric variable; optional
+}
+
+// AllowedValueRange is the range of a numeric state variable. The values are not converted; Step is optional.
+type AllowedValueRange struct {
+	Minimum string `xml:"minimum"`
+	Maximum string `xml:"maximum"`
+	Step    string `xml:"step"`
 }
 
 // Result of a Call() contains all output arguments of the call.
 // The map is indexed by the name of the state variable.
-// The type of the value is string, uint64 or bool depending on the DataType of the variable.
+// The type of the value depends on the DataType of the variable (see convertResult).
+// Values of unknown data types or values that cannot be converted are kept as string.
 type Result map[string]interface{}
 
-// Call an action.
-// Currently only actions without input arguments are supported.
+// SoapError is an UPnP error returned by the device.
+type SoapError struct {
+	Code        int    `xml:"errorCode"`
+	Description string `xml:"errorDescription"`
+}
+
+func (e *SoapError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// UPnP error codes
+const (
+	ErrorCodeInvalidArgs                = 402
+	ErrorCodeSpecifiedArrayIndexInvalid = 713
+	ErrorCodeNoSuchEntryInArray         = 714
+)
+
+// Call an action without input arguments.
 func (a *Action) Call() (Result, error) {
+	return a.CallWithArguments(nil)
+}
+
+// CallWithArguments calls an action with input arguments. The arguments are indexed by the argument name.
+func (a *Action) CallWithArguments(args map[string]string) (Result, error) {
+	return a.CallContext(context.Background(), args)
+}
+
+// CallContext calls an action with input arguments. The request is canceled with the context.
+func (a *Action) CallContext(ctx context.Context, args map[string]string) (_ Result, err error) {
+	ctx, span := tracer.Start(ctx, "Action.Call", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("upnp.service", a.service.ServiceType),
+		attribute.String("upnp.instance", a.service.Instance),
+		attribute.String("upnp.action", a.Name),
+	))
+	defer func() { endSpan(span, err) }()
+
+	for name := range args {
+		arg, ok := a.ArgumentMap[name]
+		if !ok || arg.Direction != "in" {
+			return nil, fmt.Errorf("%s has no input argument %s", a.Name, name)
+		}
+	}
+
+	// arguments in the order of the service description
+	var argsXml strings.Builder
+	for _, arg := range a.Arguments {
+		value, ok := args[arg.Name]
+		if !ok {
+			continue
+		}
+		argsXml.WriteString("<" + arg.Name + ">")
+		_ = xml.EscapeText(&argsXml, []byte(value))
+		argsXml.WriteString("</" + arg.Name + ">")
+	}
+
+	// SOAP authentication needs up to two retries: InitChallenge and stale nonce
+	const maxAuthRetries = 2
+
+	auth := a.service.Device.root.auth
+	release := auth.Acquire()
+	defer release()
+
+	logger := a.service.Device.root.logger()
+	for retry := 0; ; retry++ {
+		start := time.Now()
+		data, statusCode, status, err := a.post(ctx, logger, auth.SOAPHeader(), argsXml.String())
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("soap call", "service", a.service.ServiceType, "action", a.Name,
+			"status", statusCode, "duration", time.Since(start))
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+
+		if auth.HandleResponse(data) && retry < maxAuthRetries {
+			continue
+		}
+
+		if statusCode == 401 {
+			return nil, fmt.Errorf("cannot read service %s: status 401 unauthorized", a.Name)
+		}
+
+		if statusCode != 200 {
+			return nil, parseSoapFault(a.Name, status, data)
+		}
+
+		return a.parseSoapResponse(data)
+	}
+}
+
+// post sends a SOAP request for the action and returns the response body
+func (a *Action) post(ctx context.Context, logger *slog.Logger, header string, args string) ([]byte, int, string, error) {
+	if header != "" {
+		header = "<s:Header>" + header + "</s:Header>"
+	}
+
 	bodyStr := fmt.Sprintf(`
         <?xml version='1.0' encoding='utf-8'?>
         <s:Envelope s:encodingStyle='http://schemas.xmlsoap.org/soap/encoding/' xmlns:s='http://schemas.xmlsoap.org/soap/envelope/'>
+            %s
             <s:Body>
-                <u:%s xmlns:u='%s' />
+                <u:%s xmlns:u='%s'>%s</u:%s>
             </s:Body>
         </s:Envelope>
-    `, a.Name, a.service.ServiceType)
+    `, header, a.Name, a.service.ServiceType, args, a.Name)
 
 	url := a.service.Device.root.baseUrl + a.service.ControlUrl
 	body := strings.NewReader(bodyStr)
 
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
-		return nil, err
+		return nil, 0, "", err
 	}
 
 	action := fmt.Sprintf("%s#%s", a.service.ServiceType, a.Name)
@@ -78,22 +187,61 @@ func (a *Action) Call() (Result, error) {
 
 	client := a.service.Device.root.client
 
+	dump := logger.Enabled(ctx, slog.LevelDebug)
+	if dump {
+		logger.Debug("soap request", "action", a.Name, "body", redactSOAP(bodyStr))
+	}
+
 	resp, err := client.Transport.RoundTrip(req)
 	if err != nil {
-		return nil, fmt.Errorf("cannod call %s: %w", a.Name, err)
+		return nil, 0, "", fmt.Errorf("cannod call %s: %w", a.Name, err)
 	}
 	defer closeIgnoringError(resp.Body)
 
-	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("cannot read service %s: status 401 unauthorized", a.Name)
-	}
-
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read request body: %w", err)
+		return nil, 0, "", fmt.Errorf("cannot read request body: %w", err)
+	}
+
+	if dump {
+		logger.Debug("soap response", "action", a.Name, "status", resp.StatusCode, "body", redactSOAP(string(data)))
+	}
+
+	return data, resp.StatusCode, resp.Status, nil
+}
+
+// secretElement matches XML elements with passwords and other secrets, e.g. <NewPassword>...</NewPassword>
+var secretElement = regexp.MustCompile(`(?i)(<([\w:-]*(?:password|passwd|passphrase|secret|psk|presharedkey|wepkey|nonce|auth|pin)\d*)(?:\s[^>]*)?>)[^<]*(</)`)
+
+// sessionId matches session ids in URLs returned by actions, e.g. the URL of the call list
+var sessionId = regexp.MustCompile(`(?i)(\bsid=)[0-9a-f]+`)
+
+// redactSOAP removes secrets from a SOAP body for logging
+func redactSOAP(body string) string {
+	body = secretElement.ReplaceAllString(body, "${1}***${3}")
+	return sessionId.ReplaceAllString(body, "${1}***")
+}
+
+// Value returns the value of an output argument from the result of a call of the action.
+func (a *Action) Value(res Result, argument string) (interface{}, bool) {
+	arg, ok := a.ArgumentMap[argument]
+	if !ok || arg.StateVariable == nil {
+		return nil, false
 	}
+	val, ok := res[arg.StateVariable.Name]
+	return val, ok
+}
 
-	return a.parseSoapResponse(data)
+// parseSoapFault returns a *SoapError if the body contains an UPnP error.
+func parseSoapFault(action string, status string, data []byte) error {
+	var fault struct {
+		Error *SoapError `xml:"Body>Fault>detail>UPnPError"`
+	}
+	err := xml.Unmarshal(data, &fault)
+	if err != nil || fault.Error == nil {
+		return fmt.Errorf("cannot call %s: status %s", action, status)
+	}
+	return fault.Error
 }
 
 func (a *Action) parseSoapResponse(data []byte) (Result, error) {
@@ -113,7 +261,7 @@ func (a *Action) parseSoapResponse(data []byte) (Result, error) {
 		if se, ok := t.(xml.StartElement); ok {
 			arg, ok := a.ArgumentMap[se.Name.Local]
 
-			if ok {
+			if ok && arg.StateVariable != nil {
 				t2, err := dec.Token()
 				if err != nil {
 					return nil, err
@@ -129,46 +277,9 @@ func (a *Action) parseSoapResponse(data []byte) (Result, error) {
 					return nil, ErrInvalidSOAPResponse
 				}
 
-				converted, err := convertResult(val, arg)
-				if err != nil {
-					return nil, err
-				}
-				res[arg.StateVariable.Name] = converted
+				res[arg.StateVariable.Name] = convertResult(val, arg)
 			}
 		}
 
 	}
 }
-
-func convertResult(val string, arg *Argument) (interface{}, error) {
-	switch arg.StateVariable.DataType {
-	case "string":
-		return val, nil
-	case "boolean":
-		return val == "1", nil
-
-	case "ui1", "ui2", "ui4":
-		// type ui4 can contain values greater than 2^32!
-		res, err := strconv.ParseUint(val, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		return res, nil
-	case "i1", "i2", "i4":
-		res, err := strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		return res, nil
-	case "dateTime":
-		const timeLayout = "2006-01-02T15:04:05"
-		res, err := time.Parse(timeLayout, val)
-		if err != nil {
-			return nil, err
-		}
-		return res, nil
-	default:
-		return nil, fmt.Errorf("unknown datatype: %s: %s", arg.StateVariable.DataType, val)
-
-	}
-}
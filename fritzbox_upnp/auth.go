@@ -0,0 +1,175 @@
+package fritzbox_upnp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Authentication methods of ConnectionParameters.AuthMethod
+const (
+	AuthDigest = "digest" // HTTP digest authentication (default)
+	AuthSOAP   = "soap"   // TR-064 SOAP header authentication (InitChallenge/ClientAuth)
+)
+
+// Authenticator is a strategy to authenticate requests to the device.
+type Authenticator interface {
+	// Transport wraps the HTTP transport used for all requests.
+	Transport(t http.RoundTripper) http.RoundTripper
+
+	// SOAPHeader returns the content of the SOAP header of the next action call. Empty if no header is needed.
+	SOAPHeader() string
+
+	// HandleResponse processes the response of an action call.
+	// It returns true if the call has to be repeated with a new SOAP header, e.g. because of a stale nonce.
+	HandleResponse(data []byte) (retry bool)
+
+	// Acquire is called before an action call (including its retries); release is called after it.
+	// Authenticators that need the response of a call for the next one serialize the calls.
+	Acquire() (release func())
+}
+
+// NewAuthenticator creates the authenticator for the parameters.
+// Without username no authentication is used.
+func NewAuthenticator(params ConnectionParameters) (Authenticator, error) {
+	switch params.AuthMethod {
+	case "", AuthDigest, AuthSOAP:
+	default:
+		return nil, fmt.Errorf("unknown authentication method: %s", params.AuthMethod)
+	}
+
+	switch {
+	case params.Username == "":
+		return noAuth{}, nil
+	case params.AuthMethod == AuthSOAP:
+		return &SOAPAuth{Username: params.Username, Password: params.Password}, nil
+	default:
+		return &DigestAuth{Username: params.Username, Password: params.Password}, nil
+	}
+}
+
+func noRelease() {}
+
+type noAuth struct{}
+
+func (noAuth) Transport(t http.RoundTripper) http.RoundTripper { return t }
+func (noAuth) SOAPHeader() string                              { return "" }
+func (noAuth) HandleResponse([]byte) bool                      { return false }
+func (noAuth) Acquire() func()                                 { return noRelease }
+
+// DigestAuth uses HTTP digest authentication. The nonce of the device is reused across requests.
+type DigestAuth struct {
+	Username string
+	Password string
+}
+
+func (d *DigestAuth) Transport(t http.RoundTripper) http.RoundTripper {
+	return newDigestTransport(d.Username, d.Password, t)
+}
+
+func (d *DigestAuth) SOAPHeader() string         { return "" }
+func (d *DigestAuth) HandleResponse([]byte) bool { return false }
+func (d *DigestAuth) Acquire() func()            { return noRelease }
+
+// SOAPAuth uses the authentication in the SOAP header defined by TR-064.
+//
+// The first call sends an InitChallenge and receives nonce and realm. The following calls send a ClientAuth
+// with auth = md5(md5(user:realm:password):nonce). Every response contains the nonce for the next call.
+// If the nonce is stale the device responds with a new challenge and the call is repeated.
+// Calls are serialized: concurrent calls would use the same nonce and invalidate it for each other.
+type SOAPAuth struct {
+	Username string
+	Password string
+
+	callMu sync.Mutex // held during an action call
+
+	mu    sync.Mutex // protects nonce and realm
+	nonce string
+	realm string
+}
+
+const soapAuthNamespace = "http://soap-authentication.org/digest/2001/10/"
+
+func (s *SOAPAuth) Transport(t http.RoundTripper) http.RoundTripper {
+	return t
+}
+
+func (s *SOAPAuth) Acquire() func() {
+	s.callMu.Lock()
+	return s.callMu.Unlock
+}
+
+func (s *SOAPAuth) SOAPHeader() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf strings.Builder
+	element := func(name string, value string) {
+		buf.WriteString("<" + name + ">")
+		_ = xml.EscapeText(&buf, []byte(value))
+		buf.WriteString("</" + name + ">")
+	}
+
+	if s.nonce == "" {
+		buf.WriteString(`<h:InitChallenge xmlns:h="` + soapAuthNamespace + `" s:mustUnderstand="1">`)
+		element("UserID", s.Username)
+		buf.WriteString(`</h:InitChallenge>`)
+		return buf.String()
+	}
+
+	secret := md5Hex(s.Username + ":" + s.realm + ":" + s.Password)
+	auth := md5Hex(secret + ":" + s.nonce)
+
+	buf.WriteString(`<h:ClientAuth xmlns:h="` + soapAuthNamespace + `" s:mustUnderstand="1">`)
+	element("Nonce", s.nonce)
+	element("Auth", auth)
+	element("UserID", s.Username)
+	element("Realm", s.realm)
+	buf.WriteString(`</h:ClientAuth>`)
+	return buf.String()
+}
+
+type soapChallenge struct {
+	Status string `xml:"Status"`
+	Nonce  string `xml:"Nonce"`
+	Realm  string `xml:"Realm"`
+}
+
+func (s *SOAPAuth) HandleResponse(data []byte) bool {
+	var envelope struct {
+		Challenge     *soapChallenge `xml:"Header>Challenge"`
+		NextChallenge *soapChallenge `xml:"Header>NextChallenge"`
+	}
+	err := xml.NewDecoder(bytes.NewReader(data)).Decode(&envelope)
+	if err != nil {
+		return false
+	}
+
+	challenge := envelope.Challenge
+	if challenge == nil {
+		challenge = envelope.NextChallenge
+	}
+	if challenge == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nonce = challenge.Nonce
+	if challenge.Realm != "" {
+		s.realm = challenge.Realm
+	}
+
+	return challenge.Status == "Unauthenticated"
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,165 @@
+package fritzbox_upnp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const testDescriptor = `<?xml version="1.0"?>
+<root xmlns="urn:dslforum-org:device-1-0">
+<device>
+<deviceType>urn:dslforum-org:device:InternetGatewayDevice:1</deviceType>
+<UDN>uuid:test</UDN>
+<serviceList>
+<service>
+<serviceType>urn:dslforum-org:service:DeviceInfo:1</serviceType>
+<serviceId>urn:DeviceInfo-com:serviceId:DeviceInfo1</serviceId>
+<controlURL>/upnp/control/deviceinfo</controlURL>
+<eventSubURL>/upnp/control/deviceinfo</eventSubURL>
+<SCPDURL>/deviceinfoSCPD.xml</SCPDURL>
+</service>
+</serviceList>
+</device>
+</root>`
+
+const testSCPD = `<?xml version="1.0"?>
+<scpd xmlns="urn:dslforum-org:service-1-0">
+<actionList>
+<action>
+<name>GetInfo</name>
+<argumentList>
+<argument><name>NewUpTime</name><direction>out</direction><relatedStateVariable>UpTime</relatedStateVariable></argument>
+</argumentList>
+</action>
+</actionList>
+<serviceStateTable>
+<stateVariable><name>UpTime</name><dataType>ui4</dataType></stateVariable>
+</serviceStateTable>
+</scpd>`
+
+// soapAuthDevice is a device with TR-064 SOAP authentication. Every response carries a new nonce;
+// a call with any other nonce is rejected with a new challenge.
+type soapAuthDevice struct {
+	mu       sync.Mutex
+	nonce    int
+	rejected int
+}
+
+var clientAuth = regexp.MustCompile(`<Nonce>(\d+)</Nonce><Auth>(\w+)</Auth>`)
+
+func (d *soapAuthDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/tr64desc.xml":
+		_, _ = io.WriteString(w, testDescriptor)
+		return
+	case "/deviceinfoSCPD.xml":
+		_, _ = io.WriteString(w, testSCPD)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m := clientAuth.FindSubmatch(body)
+	current := strconv.Itoa(d.nonce)
+	d.nonce++
+	next := strconv.Itoa(d.nonce)
+
+	valid := m != nil && string(m[1]) == current &&
+		string(m[2]) == md5Hex(md5Hex("user:F!Box SOAP-Auth:secret")+":"+current)
+	if !valid {
+		if m != nil {
+			d.rejected++
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header>
+<h:Challenge xmlns:h="http://soap-authentication.org/digest/2001/10/"><Status>Unauthenticated</Status><Nonce>%s</Nonce><Realm>F!Box SOAP-Auth</Realm></h:Challenge>
+</s:Header><s:Body/></s:Envelope>`, next)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header>
+<h:NextChallenge xmlns:h="http://soap-authentication.org/digest/2001/10/"><Status>Authenticated</Status><Nonce>%s</Nonce><Realm>F!Box SOAP-Auth</Realm></h:NextChallenge>
+</s:Header><s:Body><u:GetInfoResponse xmlns:u="urn:dslforum-org:service:DeviceInfo:1"><NewUpTime>4711</NewUpTime></u:GetInfoResponse></s:Body></s:Envelope>`, next)
+}
+
+func testParameters(t *testing.T, srv *httptest.Server) ConnectionParameters {
+	t.Helper()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return ConnectionParameters{Device: u.Hostname(), Port: port}
+}
+
+func TestSOAPAuthConcurrentCalls(t *testing.T) {
+	device := &soapAuthDevice{}
+	srv := httptest.NewServer(device)
+	defer srv.Close()
+
+	params := testParameters(t, srv)
+	params.Username = "user"
+	params.Password = "secret"
+	params.AuthMethod = AuthSOAP
+
+	root, err := LoadServiceRoot(params, TR64ServiceDescriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	action := root.Services["urn:dslforum-org:service:DeviceInfo:1"].Actions["GetInfo"]
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := action.Call()
+			if err == nil && res["UpTime"] != uint64(4711) {
+				err = fmt.Errorf("unexpected result %v", res)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if device.rejected != 0 {
+		t.Errorf("%d calls used a stale nonce", device.rejected)
+	}
+}
+
+func TestNewAuthenticatorInvalidMethod(t *testing.T) {
+	for _, params := range []ConnectionParameters{
+		{AuthMethod: "basic"},
+		{AuthMethod: "basic", Username: "user"},
+	} {
+		_, err := NewAuthenticator(params)
+		if err == nil {
+			t.Errorf("%+v: expected error", params)
+		}
+	}
+
+	auth, err := NewAuthenticator(ConnectionParameters{AuthMethod: AuthSOAP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := auth.(noAuth); !ok {
+		t.Errorf("got %T without username, want noAuth", auth)
+	}
+}
@@ -0,0 +1,64 @@
+package fritzbox_upnp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceCache is the disk cache of a service descriptor and its service descriptions.
+type serviceCache struct {
+	Key        string            // identifies the device and firmware; see Root.cacheKey
+	Descriptor string            // service descriptor, e.g. tr64desc.xml
+	Documents  map[string][]byte // service descriptions indexed by SCPD URL
+}
+
+// cacheKey identifies the service descriptions of a device. It changes with a firmware update.
+// The IGD descriptor has no firmware version, so a hash of the descriptor is included.
+func (r *Root) cacheKey(descriptor []byte) string {
+	sum := sha256.Sum256(descriptor)
+	return strings.Join([]string{r.Device.UDN, r.SystemVersion, r.ConfigId, hex.EncodeToString(sum[:8])}, "|")
+}
+
+func serviceCacheFile(params ConnectionParameters, descriptor string) string {
+	name := fmt.Sprintf("%s-%s.json", params.Device, strings.TrimSuffix(descriptor, ".xml"))
+	return filepath.Join(params.CacheDir, name)
+}
+
+func readServiceCache(params ConnectionParameters, descriptor string) (*serviceCache, error) {
+	data, err := os.ReadFile(serviceCacheFile(params, descriptor))
+	if err != nil {
+		return nil, err
+	}
+
+	var cache serviceCache
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service cache for %s: %w", descriptor, err)
+	}
+	return &cache, nil
+}
+
+func writeServiceCache(params ConnectionParameters, descriptor string, root *Root, body []byte) error {
+	data, err := json.Marshal(serviceCache{
+		Key:        root.cacheKey(body),
+		Descriptor: string(body),
+		Documents:  root.documents,
+	})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a concurrent reader never sees a partial file
+	file := serviceCacheFile(params, descriptor)
+	tmp := file + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -1,34 +1,50 @@
 package fritzbox_upnp
 
 import (
-	"crypto/tls"
+	"net"
 	"net/http"
+	"time"
+)
 
-	dac "github.com/ndecker/go-http-digest-auth-client"
+// Connection pool settings. A scrape calls many actions on the same host; keeping the connections open saves
+// the TCP and TLS handshakes. The FRITZ!Box closes idle connections after some seconds, so idle connections are
+// closed earlier by the client to avoid using a connection the device is just closing.
+const (
+	maxIdleConns        = 4
+	idleConnTimeout     = 20 * time.Second
+	dialTimeout         = 10 * time.Second
+	keepAliveInterval   = 15 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
 )
 
-func setupClient(username string, password string, allowSelfsigned bool) *http.Client {
+func setupClient(params ConnectionParameters, auth Authenticator) (*http.Client, error) {
+	tlsConfig, err := NewTLSConfig(params)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAliveInterval,
+	}
+
 	var t http.RoundTripper
 	t = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: allowSelfsigned,
-		},
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     idleConnTimeout,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		TLSClientConfig:     tlsConfig,
 	}
 
-	if username != "" {
-		client := &http.Client{
-			Transport: t,
-		}
-
-		t = &dac.DigestTransport{
-			Client:   client,
-			Username: username,
-			Password: password,
-		}
+	if params.WrapTransport != nil {
+		t = params.WrapTransport(t)
 	}
 
 	client := &http.Client{
-		Transport: t,
+		Transport: auth.Transport(t),
 	}
-	return client
+	return client, nil
 }
@@ -0,0 +1,101 @@
+package fritzbox_upnp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts of the date and time data types (subsets of ISO 8601)
+const (
+	DateLayout       = "2006-01-02"
+	DateTimeLayout   = "2006-01-02T15:04:05"
+	DateTimeTZLayout = "2006-01-02T15:04:05Z07:00"
+	TimeLayout       = "15:04:05"
+	TimeTZLayout     = "15:04:05Z07:00"
+)
+
+// convertResult converts the value of an output argument according to the data type of its state variable:
+//
+//	ui1, ui2, ui4, ui8                          uint64
+//	i1, i2, i4, i8, int                         int64
+//	r4, r8, number, fixed.14.4, float           float64
+//	boolean                                     bool
+//	char, string, uri, uuid                     string
+//	date, dateTime, dateTime.tz, time, time.tz  time.Time (time and time.tz on the zero date)
+//	bin.base64, bin.hex                         []byte
+//
+// Values of unknown data types or values that cannot be converted are returned as string,
+// so a single argument does not fail the whole call.
+func convertResult(val string, arg *Argument) interface{} {
+	res, err := convertValue(val, arg.StateVariable.DataType)
+	if err != nil {
+		return val
+	}
+	return res
+}
+
+// convertValue converts a value of a data type. Returns the value as string for unknown data types.
+func convertValue(val string, dataType string) (interface{}, error) {
+	switch dataType {
+	case "string", "char", "uri", "uuid":
+		return val, nil
+
+	case "boolean":
+		return parseBool(val)
+
+	case "ui1", "ui2", "ui4", "ui8":
+		// type ui4 can contain values greater than 2^32!
+		return strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+
+	case "i1", "i2", "i4", "i8", "int":
+		return strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+
+	case "r4", "r8", "number", "fixed.14.4", "float":
+		return strconv.ParseFloat(strings.TrimSpace(val), 64)
+
+	case "date":
+		return time.Parse(DateLayout, val)
+	case "dateTime":
+		// dateTime may be a date only
+		if len(val) == len(DateLayout) {
+			return time.Parse(DateLayout, val)
+		}
+		return time.Parse(DateTimeLayout, val)
+	case "dateTime.tz":
+		if t, err := time.Parse(DateTimeTZLayout, val); err == nil {
+			return t, nil
+		}
+		// without time zone
+		return time.Parse(DateTimeLayout, val)
+	case "time":
+		return time.Parse(TimeLayout, val)
+	case "time.tz":
+		if t, err := time.Parse(TimeTZLayout, val); err == nil {
+			return t, nil
+		}
+		return time.Parse(TimeLayout, val)
+
+	case "bin.base64":
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(val))
+	case "bin.hex":
+		return hex.DecodeString(strings.TrimSpace(val))
+
+	default:
+		return val, nil
+	}
+}
+
+// parseBool parses the boolean values of UPnP: 0, 1, false, true, no, yes
+func parseBool(val string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "1", "true", "yes":
+		return true, nil
+	case "0", "false", "no", "":
+		return false, nil
+	default:
+		return false, strconv.ErrSyntax
+	}
+}
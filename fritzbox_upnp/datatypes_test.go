@@ -0,0 +1,92 @@
+package fritzbox_upnp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		dataType string
+		val      string
+		want     interface{}
+	}{
+		{"string", " text ", " text "},
+		{"char", "a", "a"},
+		{"uri", "http://fritz.box", "http://fritz.box"},
+		{"uuid", "uuid:1234", "uuid:1234"},
+		{"boolean", "1", true},
+		{"boolean", "yes", true},
+		{"boolean", "False", false},
+		{"boolean", "", false},
+		{"ui1", "255", uint64(255)},
+		{"ui2", " 65535 ", uint64(65535)},
+		{"ui4", "5000000000", uint64(5000000000)}, // ui4 values greater than 2^32 are reported
+		{"ui8", "18446744073709551615", uint64(18446744073709551615)},
+		{"i1", "-128", int64(-128)},
+		{"i2", "-32768", int64(-32768)},
+		{"i4", "-5", int64(-5)},
+		{"i8", "-9223372036854775808", int64(-9223372036854775808)},
+		{"int", "42", int64(42)},
+		{"r4", "1.5", 1.5},
+		{"r8", "-2.25", -2.25},
+		{"number", "3", 3.0},
+		{"fixed.14.4", "12.3456", 12.3456},
+		{"float", "1e3", 1000.0},
+		{"date", "2024-03-05", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"dateTime", "2024-03-05T18:30:15", time.Date(2024, 3, 5, 18, 30, 15, 0, time.UTC)},
+		{"dateTime", "2024-03-05", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"dateTime.tz", "2024-03-05T18:30:15Z", time.Date(2024, 3, 5, 18, 30, 15, 0, time.UTC)},
+		{"dateTime.tz", "2024-03-05T18:30:15", time.Date(2024, 3, 5, 18, 30, 15, 0, time.UTC)},
+		{"time", "18:30:15", time.Date(0, 1, 1, 18, 30, 15, 0, time.UTC)},
+		{"time.tz", "18:30:15Z", time.Date(0, 1, 1, 18, 30, 15, 0, time.UTC)},
+		{"time.tz", "18:30:15", time.Date(0, 1, 1, 18, 30, 15, 0, time.UTC)},
+		{"bin.base64", "AQID", []byte{1, 2, 3}},
+		{"bin.hex", "0a0b", []byte{10, 11}},
+		{"unknown", "value", "value"},
+	}
+
+	for _, tt := range tests {
+		got, err := convertValue(tt.val, tt.dataType)
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.dataType, tt.val, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: got %#v, want %#v", tt.dataType, tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestConvertValueInvalid(t *testing.T) {
+	tests := []struct {
+		dataType string
+		val      string
+	}{
+		{"boolean", "maybe"},
+		{"ui4", "-1"},
+		{"ui4", "N/A"},
+		{"i4", "1.5"},
+		{"r8", "abc"},
+		{"date", "05.03.2024"},
+		{"dateTime", "2024-03-05 18:30"},
+		{"dateTime.tz", "yesterday"},
+		{"time", "25:00:00"},
+		{"time.tz", "noon"},
+		{"bin.base64", "!!"},
+		{"bin.hex", "xyz"},
+	}
+
+	for _, tt := range tests {
+		if _, err := convertValue(tt.val, tt.dataType); err == nil {
+			t.Errorf("%s %q: no error", tt.dataType, tt.val)
+		}
+
+		// the result of a call keeps values that cannot be converted as string
+		arg := &Argument{StateVariable: &StateVariable{DataType: tt.dataType}}
+		if got := convertResult(tt.val, arg); got != tt.val {
+			t.Errorf("%s %q: result %#v, want the string", tt.dataType, tt.val, got)
+		}
+	}
+}
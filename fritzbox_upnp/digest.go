@@ -0,0 +1,262 @@
+package fritzbox_upnp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestTransport implements HTTP digest authentication (RFC 7616).
+//
+// The challenge of the device is remembered and reused for the following requests with an increasing nonce count.
+// This saves the 401 round trip of every request. A new challenge is only requested when the device rejects the
+// nonce (e.g. because it is stale).
+type digestTransport struct {
+	username  string
+	password  string
+	transport http.RoundTripper
+
+	mu        sync.Mutex       // protects challenge and nc
+	challenge *digestChallenge // nil if no challenge was received yet
+	nc        uint32           // nonce count of the challenge
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string // "auth" or empty
+}
+
+func newDigestTransport(username string, password string, t http.RoundTripper) *digestTransport {
+	return &digestTransport{
+		username:  username,
+		password:  password,
+		transport: t,
+	}
+}
+
+func (d *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.GetBody != nil {
+		// every attempt sends a new body from GetBody; the original body is never passed on
+		defer closeIgnoringError(req.Body)
+	}
+
+	if auth := d.authorization(req); auth != "" {
+		resp, err := d.send(req, auth)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		// nonce rejected: use the new challenge of the response
+		return d.retry(req, resp)
+	}
+
+	resp, err := d.send(req, "")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	return d.retry(req, resp)
+}
+
+// retry parses the challenge of a 401 response and repeats the request with it.
+func (d *digestTransport) retry(req *http.Request, resp *http.Response) (*http.Response, error) {
+	c, err := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		// no digest challenge; return the 401 response to the caller
+		return resp, nil
+	}
+	discardBody(resp)
+
+	d.mu.Lock()
+	d.challenge = c
+	d.nc = 0
+	d.mu.Unlock()
+
+	if req.Body != nil && req.GetBody == nil {
+		return nil, fmt.Errorf("cannot repeat request to %s for digest authentication", req.URL)
+	}
+	return d.send(req, d.authorization(req))
+}
+
+func (d *digestTransport) send(req *http.Request, auth string) (*http.Response, error) {
+	req2 := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req2.Body = body
+	}
+	if auth != "" {
+		req2.Header.Set("Authorization", auth)
+	}
+	return d.transport.RoundTrip(req2)
+}
+
+// authorization returns the Authorization header for the request with the current challenge.
+// Returns an empty string if no challenge was received yet.
+func (d *digestTransport) authorization(req *http.Request) string {
+	d.mu.Lock()
+	c := d.challenge
+	if c == nil {
+		d.mu.Unlock()
+		return ""
+	}
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+	d.mu.Unlock()
+
+	h := c.hash()
+	hashHex := func(s string) string {
+		hh := h()
+		_, _ = io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	cnonce := newCnonce()
+	uri := req.URL.RequestURI()
+
+	ha1 := hashHex(d.username + ":" + c.realm + ":" + d.password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = hashHex(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := hashHex(req.Method + ":" + uri)
+
+	var response string
+	if c.qop != "" {
+		response = hashHex(strings.Join([]string{ha1, c.nonce, nc, cnonce, c.qop, ha2}, ":"))
+	} else {
+		response = hashHex(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username=%s, realm=%s, nonce=%s, uri=%s, response="%s"`,
+		quoteParam(d.username), quoteParam(c.realm), quoteParam(c.nonce), quoteParam(uri), response)
+	if c.algorithm != "" {
+		fmt.Fprintf(&b, `, algorithm=%s`, c.algorithm)
+	}
+	if c.opaque != "" {
+		fmt.Fprintf(&b, `, opaque=%s`, quoteParam(c.opaque))
+	}
+	if c.qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s"`, c.qop, nc, cnonce)
+	}
+	return b.String()
+}
+
+// parseDigestChallenge parses a WWW-Authenticate header like
+// Digest realm="HTTPS Access", nonce="A1B2C3", algorithm=MD5, qop="auth"
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	const prefix = "digest "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, fmt.Errorf("no digest challenge: %q", header)
+	}
+
+	params := parseAuthParams(header[len(prefix):])
+	c := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+	}
+	if c.nonce == "" {
+		return nil, fmt.Errorf("digest challenge without nonce: %q", header)
+	}
+
+	// qop is a list of options; only auth is supported
+	for _, qop := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			c.qop = "auth"
+		}
+	}
+
+	if c.hash() == nil {
+		return nil, fmt.Errorf("unsupported digest algorithm: %s", c.algorithm)
+	}
+	return c, nil
+}
+
+// hash returns the hash function of the algorithm or nil if the algorithm is not supported
+func (c *digestChallenge) hash() func() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	default:
+		return nil
+	}
+}
+
+// parseAuthParams parses a comma separated list of key=value pairs. Values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++ // closing quote
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+}
+
+// quoteParam returns s as a quoted string with '"' and '\' escaped (RFC 7230 quoted-string).
+func quoteParam(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func newCnonce() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// discardBody reads and closes the body so the connection can be reused.
+func discardBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	closeIgnoringError(resp.Body)
+}
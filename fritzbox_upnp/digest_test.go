@@ -0,0 +1,75 @@
+package fritzbox_upnp
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// challengeTransport answers requests without Authorization header with a digest challenge.
+type challengeTransport struct {
+	auth []string // Authorization headers of all requests
+}
+
+func (t *challengeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		closeIgnoringError(req.Body)
+	}
+
+	auth := req.Header.Get("Authorization")
+	t.auth = append(t.auth, auth)
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(""))}
+	if auth == "" {
+		resp.StatusCode = http.StatusUnauthorized
+		resp.Header.Set("WWW-Authenticate", `Digest realm="HTTPS Access", nonce="A1B2C3", algorithm=MD5, qop="auth"`)
+	}
+	return resp, nil
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDigestTransport(t *testing.T) {
+	next := &challengeTransport{}
+	d := newDigestTransport(`a"b\c`, "secret", next)
+
+	req, err := http.NewRequest("POST", "http://fritz.box:49000/upnp/control/deviceinfo", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := &closeRecorder{Reader: req.Body}
+	req.Body = body
+
+	resp, err := d.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discardBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d, want 200", resp.StatusCode)
+	}
+	if !body.closed {
+		t.Error("request body not closed")
+	}
+	if len(next.auth) != 2 {
+		t.Fatalf("%d requests, want 2", len(next.auth))
+	}
+
+	params := parseAuthParams(strings.TrimPrefix(next.auth[1], "Digest "))
+	if got := params["username"]; got != `a"b\c` {
+		t.Errorf("username %q, want %q", got, `a"b\c`)
+	}
+	if got := params["nonce"]; got != "A1B2C3" {
+		t.Errorf("nonce %q, want A1B2C3", got)
+	}
+}
@@ -17,12 +17,19 @@ package fritzbox_upnp
 
 import (
 	"bytes"
+	"context"
+	"crypto/x509"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // curl http://fritz.box:49000/igddesc.xml
@@ -45,15 +52,43 @@ type ConnectionParameters struct {
 	Username        string
 	Password        string
 	AllowSelfSigned bool
+	AuthMethod      string // AuthDigest or AuthSOAP
+
+	TLSPin        string // SHA-256 fingerprint of the certificate of the device; optional
+	TLSPinFile    string // file with the pinned fingerprint; the first certificate is pinned if it does not exist
+	TLSCAFile     string // PEM file with CA certificates to verify the device; optional
+	TLSServerName string // name to verify the certificate against instead of Device; optional
+
+	OnCertificate func(cert *x509.Certificate) // called for the certificate of every TLS connection. Optional.
+	OnPinMismatch func(err *PinMismatchError)  // called if the certificate does not match the pin. Optional.
+
+	CacheDir string // directory to cache the service descriptions; optional
+
+	// Logger for debug output of calls. Optional; slog.Default() if not set.
+	// On debug level the SOAP requests and responses are logged with passwords and secrets removed.
+	Logger *slog.Logger
+
+	// WrapTransport wraps the HTTP transport below the authentication, e.g. to instrument all requests. Optional.
+	WrapTransport func(http.RoundTripper) http.RoundTripper
 }
 
 // Root of the UPNP tree
 type Root struct {
 	client   *http.Client
+	auth     Authenticator
 	baseUrl  string
 	params   ConnectionParameters
 	Device   Device              `xml:"device"`
-	Services map[string]*Service // Map of all services indexed by .ServiceType
+	Services map[string]*Service // Map of all services indexed by .ServiceType. The first service of a type is used.
+
+	SystemVersion string `xml:"systemVersion>Display"` // firmware version; only in the TR64 descriptor
+	ConfigId      string `xml:"configId,attr"`         // changes with the service descriptions; optional
+
+	documents map[string][]byte // service descriptions indexed by SCPD URL; loaded from the cache or the device
+	offline   bool              // only use documents, do not load from the device
+
+	ServiceList []*Service          // All services in the order of the service descriptor
+	Instances   map[string]*Service // Map of all services indexed by .Instance
 }
 
 // Device represents a UPNP Device
@@ -74,6 +109,10 @@ type Device struct {
 	Devices  []*Device  `xml:"deviceList>device"`   // Sub-Devices of the device
 
 	PresentationUrl string `xml:"presentationURL"`
+
+	// Path identifies the device within the service descriptor, e.g. tr64desc/WANDevice:1/WANConnectionDevice:1[1].
+	// Sub-devices of the same type are numbered.
+	Path string `xml:"-"`
 }
 
 // Service represents a UPNP Service
@@ -88,6 +127,10 @@ type Service struct {
 
 	Actions        map[string]*Action // All actions available on the service
 	StateVariables []*StateVariable   // All state variables available on the service
+
+	// Instance identifies the service by device path and service id, e.g. tr64desc/LANDevice:1/WLANConfiguration2.
+	// Services of the same type in different devices or with different ids have different instances.
+	Instance string `xml:"-"`
 }
 
 type scpdRoot struct {
@@ -96,20 +139,18 @@ type scpdRoot struct {
 }
 
 // load all service descriptions
-func (d *Device) fillServices(r *Root) error {
+func (d *Device) fillServices(ctx context.Context, r *Root, path string) (err error) {
+	ctx, span := tracer.Start(ctx, "fillServices", trace.WithAttributes(attribute.String("upnp.device", path)))
+	defer func() { endSpan(span, err) }()
+
 	d.root = r
+	d.Path = path
 
 	for _, s := range d.Services {
 		s.Device = d
+		s.Instance = path + "/" + shortName(s.ServiceId, ":serviceId:")
 
-		response, err := r.client.Get(r.baseUrl + s.SCPDUrl)
-		if err != nil {
-			return fmt.Errorf("cannot load services for %s: %w", s.SCPDUrl, err)
-		}
-
-		var scpd scpdRoot
-		dec := xml.NewDecoder(response.Body)
-		err = dec.Decode(&scpd)
+		scpd, err := r.loadSCPD(ctx, s.SCPDUrl)
 		if err != nil {
 			return err
 		}
@@ -135,10 +176,27 @@ func (d *Device) fillServices(r *Root) error {
 			}
 		}
 
-		r.Services[s.ServiceType] = s
+		if _, ok := r.Services[s.ServiceType]; !ok {
+			r.Services[s.ServiceType] = s
+		}
+		r.ServiceList = append(r.ServiceList, s)
+		r.Instances[s.Instance] = s
 	}
+
+	numTypes := make(map[string]int)
 	for _, d2 := range d.Devices {
-		err := d2.fillServices(r)
+		numTypes[d2.DeviceType]++
+	}
+
+	index := make(map[string]int)
+	for _, d2 := range d.Devices {
+		subPath := path + "/" + shortName(d2.DeviceType, ":device:")
+		if numTypes[d2.DeviceType] > 1 {
+			subPath += fmt.Sprintf("[%d]", index[d2.DeviceType])
+			index[d2.DeviceType]++
+		}
+
+		err := d2.fillServices(ctx, r, subPath)
 		if err != nil {
 			return err
 		}
@@ -146,8 +204,66 @@ func (d *Device) fillServices(r *Root) error {
 	return nil
 }
 
-// LoadServiceRoot loads a service descriptor and populates a Service Root
-func LoadServiceRoot(params ConnectionParameters, descriptor string) (*Root, error) {
+// loadSCPD loads a service description from the documents or the device
+func (r *Root) loadSCPD(ctx context.Context, scpdUrl string) (*scpdRoot, error) {
+	data, ok := r.documents[scpdUrl]
+	if !ok {
+		if r.offline {
+			return nil, fmt.Errorf("service description %s not cached", scpdUrl)
+		}
+
+		var err error
+		data, err = r.fetch(ctx, r.baseUrl+scpdUrl)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load services for %s: %w", scpdUrl, err)
+		}
+		r.documents[scpdUrl] = data
+	}
+
+	var scpd scpdRoot
+	err := xml.Unmarshal(data, &scpd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", scpdUrl, err)
+	}
+	return &scpd, nil
+}
+
+// fetch loads a document from the device
+func (r *Root) fetch(ctx context.Context, docUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", docUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeIgnoringError(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("cannot fetch %s: status %s", docUrl, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return body, nil
+}
+
+// shortName removes the urn prefix of device types and service ids:
+// urn:dslforum-org:device:LANDevice:1 -> LANDevice:1
+func shortName(urn string, sep string) string {
+	i := strings.Index(urn, sep)
+	if i < 0 {
+		return urn
+	}
+	return urn[i+len(sep):]
+}
+
+// newRoot creates a Root without services
+func newRoot(params ConnectionParameters) (*Root, error) {
 	var baseUrl string
 	if params.UseTLS {
 		baseUrl = fmt.Sprintf("https://%s:%d", params.Device, params.PortTLS)
@@ -156,11 +272,43 @@ func LoadServiceRoot(params ConnectionParameters, descriptor string) (*Root, err
 
 	}
 
-	var root = &Root{
-		params:   params,
-		client:   setupClient(params.Username, params.Password, params.AllowSelfSigned),
-		baseUrl:  baseUrl,
-		Services: make(map[string]*Service),
+	auth, err := NewAuthenticator(params)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := setupClient(params, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Root{
+		params:    params,
+		auth:      auth,
+		client:    client,
+		baseUrl:   baseUrl,
+		Services:  make(map[string]*Service),
+		Instances: make(map[string]*Service),
+		documents: make(map[string][]byte),
+	}, nil
+}
+
+// LoadServiceRoot loads a service descriptor and populates a Service Root.
+//
+// With a CacheDir the service descriptions are cached. The descriptor is always loaded from the device; if it
+// identifies the same device and firmware as the cache the service descriptions are taken from the cache.
+func LoadServiceRoot(params ConnectionParameters, descriptor string) (*Root, error) {
+	return LoadServiceRootContext(context.Background(), params, descriptor)
+}
+
+// LoadServiceRootContext is LoadServiceRoot with a context.
+func LoadServiceRootContext(ctx context.Context, params ConnectionParameters, descriptor string) (_ *Root, err error) {
+	ctx, span := tracer.Start(ctx, "LoadServiceRoot", trace.WithAttributes(attribute.String("upnp.descriptor", descriptor)))
+	defer func() { endSpan(span, err) }()
+
+	root, err := newRoot(params)
+	if err != nil {
+		return nil, err
 	}
 
 	descUrl, err := url.JoinPath(root.baseUrl, descriptor)
@@ -168,7 +316,12 @@ func LoadServiceRoot(params ConnectionParameters, descriptor string) (*Root, err
 		return nil, err
 	}
 
-	igddesc, err := root.client.Get(descUrl)
+	req, err := http.NewRequestWithContext(ctx, "GET", descUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	igddesc, err := root.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -183,21 +336,95 @@ func LoadServiceRoot(params ConnectionParameters, descriptor string) (*Root, err
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	dec := xml.NewDecoder(bytes.NewReader(body))
+	err = root.decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache *serviceCache
+	if params.CacheDir != "" {
+		cache, err = readServiceCache(params, descriptor)
+		if err == nil && cache.Key == root.cacheKey(body) {
+			root.documents = cache.Documents
+		} else {
+			cache = nil
+		}
+	}
+
+	err = root.Device.fillServices(ctx, root, strings.TrimSuffix(descriptor, ".xml"))
+	if err != nil {
+		return nil, err
+	}
+
+	if params.CacheDir != "" && cache == nil {
+		// the cache is only an optimization; the services are loaded from the device if it cannot be written
+		err = writeServiceCache(params, descriptor, root, body)
+		if err != nil {
+			root.logger().Warn("cannot write service cache", "descriptor", descriptor, "error", err)
+		}
+	}
+	return root, nil
+}
+
+// LoadCachedServiceRoot loads a service descriptor and the service descriptions from the cache in CacheDir
+// without contacting the device.
+func LoadCachedServiceRoot(params ConnectionParameters, descriptor string) (*Root, error) {
+	cache, err := readServiceCache(params, descriptor)
+	if err != nil {
+		return nil, err
+	}
 
-	err = dec.Decode(root)
+	root, err := newRoot(params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode igdesc.xml: %w; body: %s", err, body)
+		return nil, err
 	}
+	root.documents = cache.Documents
+	root.offline = true
 
-	err = root.Device.fillServices(root)
+	err = root.decode([]byte(cache.Descriptor))
 	if err != nil {
 		return nil, err
 	}
+	if root.cacheKey([]byte(cache.Descriptor)) != cache.Key {
+		return nil, fmt.Errorf("invalid service cache for %s", descriptor)
+	}
 
+	err = root.Device.fillServices(context.Background(), root, strings.TrimSuffix(descriptor, ".xml"))
+	if err != nil {
+		return nil, err
+	}
 	return root, nil
 }
 
+// decode decodes the service descriptor
+func (r *Root) decode(body []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+
+	err := dec.Decode(r)
+	if err != nil {
+		return fmt.Errorf("failed to decode igdesc.xml: %w; body: %s", err, body)
+	}
+	return nil
+}
+
+// Fetch loads a document from the device (e.g. an URL returned by an action) with the client of the service.
+// Relative URLs are resolved against the base URL of the device.
+func (s *Service) Fetch(docUrl string) ([]byte, error) {
+	if strings.HasPrefix(docUrl, "/") {
+		docUrl = s.Device.root.baseUrl + docUrl
+	}
+
+	return s.Device.root.fetch(context.Background(), docUrl)
+}
+
+// logger returns the logger of the connection parameters
+func (r *Root) logger() *slog.Logger {
+	if r.params.Logger != nil {
+		return r.params.Logger
+	}
+	return slog.Default()
+}
+
 // closeIgnoringError closes c an ignores errors
 func closeIgnoringError(c io.Closer) {
 	_ = c.Close()
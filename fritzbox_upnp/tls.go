@@ -0,0 +1,157 @@
+package fritzbox_upnp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// PinMismatchError is returned by the TLS handshake if the certificate of the device does not match the pin.
+type PinMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("certificate fingerprint %s does not match pinned fingerprint %s", e.Actual, e.Expected)
+}
+
+// CertificateFingerprint returns the hex encoded SHA-256 fingerprint of a certificate.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint accepts fingerprints in the forms "AB:CD:..." and "abcd..."
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
+
+// NewTLSConfig creates the TLS configuration for connections to the device.
+//
+// With a pin (TLSPin or TLSPinFile) the certificate chain is not verified; instead the SHA-256 fingerprint of the
+// certificate of the device must match the pin. If TLSPinFile does not exist the first certificate seen is pinned
+// and written to the file (trust on first use).
+// Otherwise the certificate is verified against the system roots or TLSCAFile unless AllowSelfSigned is set.
+// If the chain is not verified, the name of the certificate is still checked against TLSServerName if it is set.
+//
+// All configurations for the same device and pin share the pin, so that all clients trust the same certificate.
+func NewTLSConfig(params ConnectionParameters) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         params.TLSServerName,
+		InsecureSkipVerify: params.AllowSelfSigned,
+	}
+
+	if params.TLSCAFile != "" {
+		pem, err := os.ReadFile(params.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", params.TLSCAFile)
+		}
+		config.RootCAs = pool
+		config.InsecureSkipVerify = false
+	}
+
+	var pinner *tlsPinner
+	if params.TLSPin != "" || params.TLSPinFile != "" {
+		pinner = sharedPinner(params)
+		// the pin replaces the verification of the certificate chain
+		config.InsecureSkipVerify = true
+	}
+
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no certificate from device")
+		}
+		cert := cs.PeerCertificates[0]
+
+		if params.OnCertificate != nil {
+			params.OnCertificate(cert)
+		}
+
+		if config.InsecureSkipVerify && params.TLSServerName != "" {
+			err := cert.VerifyHostname(params.TLSServerName)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pinner == nil {
+			return nil
+		}
+		err := pinner.verify(cert)
+		var mismatch *PinMismatchError
+		if errors.As(err, &mismatch) && params.OnPinMismatch != nil {
+			params.OnPinMismatch(mismatch)
+		}
+		return err
+	}
+
+	return config, nil
+}
+
+// tlsPinner verifies certificates against a pinned fingerprint.
+type tlsPinner struct {
+	sync.Mutex
+	pin  string // empty if not pinned yet
+	file string // pin file for trust on first use; optional
+}
+
+var (
+	pinnersMu sync.Mutex
+	pinners   = make(map[string]*tlsPinner) // indexed by device, pin and pin file
+)
+
+// sharedPinner returns the pinner for the device and pin of the parameters.
+func sharedPinner(params ConnectionParameters) *tlsPinner {
+	pin := normalizeFingerprint(params.TLSPin)
+	key := params.Device + "\x00" + pin + "\x00" + params.TLSPinFile
+
+	pinnersMu.Lock()
+	defer pinnersMu.Unlock()
+
+	p, ok := pinners[key]
+	if !ok {
+		p = &tlsPinner{pin: pin, file: params.TLSPinFile}
+		pinners[key] = p
+	}
+	return p
+}
+
+func (p *tlsPinner) verify(cert *x509.Certificate) error {
+	p.Lock()
+	defer p.Unlock()
+
+	fingerprint := CertificateFingerprint(cert)
+
+	if p.pin == "" && p.file != "" {
+		data, err := os.ReadFile(p.file)
+		switch {
+		case err == nil:
+			p.pin = normalizeFingerprint(string(data))
+		case errors.Is(err, os.ErrNotExist):
+			// trust on first use
+			err = os.WriteFile(p.file, []byte(fingerprint+"\n"), 0600)
+			if err != nil {
+				return fmt.Errorf("cannot write pin file: %w", err)
+			}
+			p.pin = fingerprint
+		default:
+			return fmt.Errorf("cannot read pin file: %w", err)
+		}
+	}
+
+	if fingerprint != p.pin {
+		return &PinMismatchError{Expected: p.pin, Actual: fingerprint}
+	}
+	return nil
+}
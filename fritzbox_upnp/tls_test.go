@@ -0,0 +1,66 @@
+package fritzbox_upnp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func tlsGet(t *testing.T, srv *httptest.Server, params ConnectionParameters) error {
+	t.Helper()
+	config, err := NewTLSConfig(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestTLSServerNameWithSelfSigned(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	params := testParameters(t, srv)
+	params.AllowSelfSigned = true
+
+	// the test certificate is issued for example.com
+	params.TLSServerName = "example.com"
+	if err := tlsGet(t, srv, params); err != nil {
+		t.Errorf("matching server name: %v", err)
+	}
+
+	params.TLSServerName = "fritz.box"
+	if err := tlsGet(t, srv, params); err == nil {
+		t.Error("other server name: no error")
+	}
+}
+
+func TestTLSPinSharedPerDevice(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	params := testParameters(t, srv)
+	params.TLSPinFile = filepath.Join(t.TempDir(), "pin")
+
+	if sharedPinner(params) != sharedPinner(params) {
+		t.Error("different pinners for the same device")
+	}
+
+	if err := tlsGet(t, srv, params); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if pin := sharedPinner(params).pin; pin != CertificateFingerprint(srv.Certificate()) {
+		t.Errorf("pinned %q, want fingerprint of the server certificate", pin)
+	}
+
+	other := params
+	other.Device = "other.test"
+	if sharedPinner(other) == sharedPinner(params) {
+		t.Error("same pinner for different devices")
+	}
+}
@@ -0,0 +1,28 @@
+package fritzbox_upnp
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the package with the global tracer provider. Spans are only recorded if the
+// application sets up a tracer provider.
+var tracer = otel.Tracer("github.com/ndecker/fritzbox_exporter/fritzbox_upnp")
+
+// endSpan records the error (if any) and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		var soapErr *SoapError
+		if errors.As(err, &soapErr) {
+			span.SetAttributes(attribute.Int("upnp.error_code", soapErr.Code))
+		}
+	}
+	span.End()
+}
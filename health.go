@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// readiness is the JSON body returned by the /-/ready endpoint.
+type readiness struct {
+	Ready      bool       `json:"ready"`
+	Missing    []string   `json:"missing,omitempty"`
+	LastScrape *time.Time `json:"last_scrape,omitempty"`
+}
+
+// readiness checks if all services are loaded and the last scrape reached the device.
+// Before the first scrape only the services are checked.
+func (fc *FritzboxCollector) readiness() readiness {
+	fc.statusMu.Lock()
+	defer fc.statusMu.Unlock()
+
+	var r readiness
+	if !fc.igdLoaded {
+		r.Missing = append(r.Missing, "IGD services not loaded")
+	}
+	if fc.Parameters.Username != "" && !fc.tr64Loaded {
+		r.Missing = append(r.Missing, "TR64 services not loaded")
+	}
+	if fc.lastScrape.Err != nil {
+		r.Missing = append(r.Missing, fmt.Sprintf("last scrape did not reach the device: %s", fc.lastScrape.Err))
+	}
+	if !fc.lastScrape.Time.IsZero() {
+		t := fc.lastScrape.Time
+		r.LastScrape = &t
+	}
+	r.Ready = len(r.Missing) == 0
+	return r
+}
+
+// healthyHandler returns 200 as long as the process is alive.
+func healthyHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"healthy":true}` + "\n"))
+}
+
+// readyHandler returns 200 if the collector is ready and 503 otherwise.
+func (fc *FritzboxCollector) readyHandler(w http.ResponseWriter, _ *http.Request) {
+	r := fc.readiness()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !r.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(r)
+}
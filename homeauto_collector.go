@@ -0,0 +1,148 @@
+package main
+
+import (
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const homeautoService = "urn:dslforum-org:service:X_AVM-DE_Homeauto:1"
+
+// maxHomeautoDevices limits the number of devices read in one scrape
+const maxHomeautoDevices = 256
+
+var (
+	homeautoLabels = []string{"gateway", "ain", "name", "product"}
+
+	homeautoPresentDesc = prometheus.NewDesc("fritzbox_homeauto_device_present",
+		"Smart home device is connected (1) or not (0).", homeautoLabels, nil)
+	homeautoSwitchStateDesc = prometheus.NewDesc("fritzbox_homeauto_switch_state",
+		"Switch state of a smart home plug (on = 1).", homeautoLabels, nil)
+	homeautoPowerDesc = prometheus.NewDesc("fritzbox_homeauto_power_watts",
+		"Current power consumption in watts.", homeautoLabels, nil)
+	homeautoEnergyDesc = prometheus.NewDesc("fritzbox_homeauto_energy_watt_hours_total",
+		"Total energy consumption in watt hours.", homeautoLabels, nil)
+	homeautoTemperatureDesc = prometheus.NewDesc("fritzbox_homeauto_temperature_celsius",
+		"Temperature measured by the device in °C.", homeautoLabels, nil)
+	homeautoThermostatCurrentDesc = prometheus.NewDesc("fritzbox_homeauto_thermostat_current_celsius",
+		"Current temperature measured by the thermostat in °C.", homeautoLabels, nil)
+	homeautoThermostatTargetDesc = prometheus.NewDesc("fritzbox_homeauto_thermostat_target_celsius",
+		"Target temperature of the thermostat in °C.", homeautoLabels, nil)
+)
+
+// HomeautoCollector collects smart home devices through the TR64 service X_AVM-DE_Homeauto.
+// It uses the services loaded by a FritzboxCollector.
+//
+// All devices are read from the table GetGenericDeviceInfos. If AINs are given, only these devices are read with
+// GetSpecificDeviceInfos. GetInfo is not used: it only reports the allowed characters and lengths of AINs and names.
+type HomeautoCollector struct {
+	fc   *FritzboxCollector
+	ains []string // devices to read; all if empty
+}
+
+func NewHomeautoCollector(fc *FritzboxCollector, ains []string) *HomeautoCollector {
+	return &HomeautoCollector{fc: fc, ains: ains}
+}
+
+func (hc *HomeautoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- homeautoPresentDesc
+	ch <- homeautoSwitchStateDesc
+	ch <- homeautoPowerDesc
+	ch <- homeautoEnergyDesc
+	ch <- homeautoTemperatureDesc
+	ch <- homeautoThermostatCurrentDesc
+	ch <- homeautoThermostatTargetDesc
+}
+
+func (hc *HomeautoCollector) Collect(ch chan<- prometheus.Metric) {
+	hc.fc.RLock()
+	defer hc.fc.RUnlock()
+
+	service, ok := hc.fc.services[homeautoService]
+	if !ok {
+		serviceNotFound.WithLabelValues(homeautoService).Inc()
+		return
+	}
+
+	if len(hc.ains) > 0 {
+		hc.collectSpecific(ch, service)
+		return
+	}
+
+	action, ok := service.Actions["GetGenericDeviceInfos"]
+	if !ok {
+		actionNotFound.WithLabelValues("GetGenericDeviceInfos").Inc()
+		return
+	}
+
+	err := readTable(action, "NewIndex", maxHomeautoDevices, func(res upnp.Result) {
+		hc.exportDevice(ch, action, res, resultString(action, res, "NewAIN"))
+	})
+	if err != nil {
+		logError("cannot read smart home devices", err)
+	}
+}
+
+// collectSpecific reads the configured devices by AIN
+func (hc *HomeautoCollector) collectSpecific(ch chan<- prometheus.Metric, service *upnp.Service) {
+	action, ok := service.Actions["GetSpecificDeviceInfos"]
+	if !ok {
+		actionNotFound.WithLabelValues("GetSpecificDeviceInfos").Inc()
+		return
+	}
+
+	for _, ain := range hc.ains {
+		numCalls.Inc()
+		res, err := action.CallWithArguments(map[string]string{"NewAIN": ain})
+		if err != nil {
+			logError("cannot read smart home device", err, "ain", ain)
+			continue
+		}
+		hc.exportDevice(ch, action, res, ain)
+	}
+}
+
+// exportDevice exports a device of GetGenericDeviceInfos or GetSpecificDeviceInfos. The latter does not report
+// the AIN.
+func (hc *HomeautoCollector) exportDevice(ch chan<- prometheus.Metric, action *upnp.Action, res upnp.Result, ain string) {
+	str := func(name string) string {
+		val, _ := action.Value(res, name)
+		s, _ := val.(string)
+		return s
+	}
+	labels := []string{hc.fc.Parameters.Device, ain, str("NewDeviceName"), str("NewProductName")}
+
+	// export exports a numeric value if the function of the device is valid
+	export := func(desc *prometheus.Desc, valueType prometheus.ValueType, valid string, name string, scale float64) {
+		if valid != "" && str(valid) != "VALID" {
+			return
+		}
+		val, _ := action.Value(res, name)
+		f, ok := toFloat(val, "")
+		if !ok {
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(desc, valueType, f*scale, labels...)
+	}
+
+	present := str("NewPresent") == "CONNECTED"
+	ch <- prometheus.MustNewConstMetric(homeautoPresentDesc, prometheus.GaugeValue, boolFloat(present), labels...)
+	if !present {
+		// all other values are invalid
+		return
+	}
+
+	if str("NewSwitchIsValid") == "VALID" {
+		switch str("NewSwitchState") {
+		case "ON":
+			ch <- prometheus.MustNewConstMetric(homeautoSwitchStateDesc, prometheus.GaugeValue, 1, labels...)
+		case "OFF":
+			ch <- prometheus.MustNewConstMetric(homeautoSwitchStateDesc, prometheus.GaugeValue, 0, labels...)
+		}
+	}
+
+	export(homeautoPowerDesc, prometheus.GaugeValue, "NewMultimeterIsValid", "NewMultimeterPower", 0.01)
+	export(homeautoEnergyDesc, prometheus.CounterValue, "NewMultimeterIsValid", "NewMultimeterEnergy", 1)
+	export(homeautoTemperatureDesc, prometheus.GaugeValue, "NewTemperatureIsValid", "NewTemperatureCelsius", 0.1)
+	export(homeautoThermostatCurrentDesc, prometheus.GaugeValue, "NewHkrIsValid", "NewHkrIsTemperature", 0.1)
+	export(homeautoThermostatTargetDesc, prometheus.GaugeValue, "NewHkrIsValid", "NewHkrSetTemperature", 0.1)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logForwarder sends entries of the device log to a log system
+type logForwarder interface {
+	forward(entries []logEntry) error
+}
+
+// newLogForwarder creates a forwarder from a target description:
+//
+//	stdout
+//	syslog+udp://host:514
+//	syslog+tcp://host:514
+//	syslog+tls://host:6514
+//	http://loki:3100    (Loki push API)
+func newLogForwarder(target string, gateway string) (logForwarder, error) {
+	if target == "stdout" {
+		return &stdoutForwarder{}, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log forward target %s: %w", target, err)
+	}
+
+	switch u.Scheme {
+	case "syslog+udp", "syslog+tcp", "syslog+tls":
+		return &syslogForwarder{
+			network: strings.TrimPrefix(u.Scheme, "syslog+"),
+			address: u.Host,
+			gateway: gateway,
+		}, nil
+	case "http", "https":
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/push"
+		}
+		return &lokiForwarder{
+			url:     u.String(),
+			gateway: gateway,
+			client:  &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid log forward target %s", target)
+	}
+}
+
+type stdoutForwarder struct{}
+
+func (f *stdoutForwarder) forward(entries []logEntry) error {
+	for _, e := range entries {
+		_, err := fmt.Fprintf(os.Stdout, "%s\n", e.Line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syslogForwarder sends RFC 5424 messages
+type syslogForwarder struct {
+	network string // udp, tcp or tls
+	address string
+	gateway string
+}
+
+func (f *syslogForwarder) forward(entries []logEntry) error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if f.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", f.address, nil)
+	} else {
+		conn, err = dialer.Dial(f.network, f.address)
+	}
+	if err != nil {
+		return err
+	}
+	defer closeIgnoringError(conn)
+
+	for _, e := range entries {
+		msg := syslogMessage(e, f.gateway)
+		if f.network != "udp" {
+			// octet counting framing (RFC 6587)
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		}
+		_, err = conn.Write([]byte(msg))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syslogMessage formats an entry as RFC 5424 message with facility daemon and severity info
+func syslogMessage(e logEntry, gateway string) string {
+	const priority = 3*8 + 6
+
+	timestamp := "-"
+	if !e.Time.IsZero() {
+		timestamp = e.Time.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("<%d>1 %s %s fritzbox - %s - %s", priority, timestamp, gateway, e.Category, e.Message)
+}
+
+// lokiForwarder sends entries to the Loki push API
+type lokiForwarder struct {
+	url     string
+	gateway string
+	client  *http.Client
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (f *lokiForwarder) forward(entries []logEntry) error {
+	streams := make(map[string]*lokiStream)
+	var request struct {
+		Streams []*lokiStream `json:"streams"`
+	}
+
+	for _, e := range entries {
+		s, ok := streams[e.Category]
+		if !ok {
+			s = &lokiStream{Stream: map[string]string{
+				"job":      "fritzbox",
+				"gateway":  f.gateway,
+				"category": e.Category,
+			}}
+			streams[e.Category] = s
+			request.Streams = append(request.Streams, s)
+		}
+
+		t := e.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(t.UnixNano(), 10), e.Line})
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Post(f.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer closeIgnoringError(resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	err = fmt.Errorf("loki push failed: status %s", resp.Status)
+	if msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)); len(bytes.TrimSpace(msg)) > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(msg))
+	}
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		// Loki will never accept the entries, e.g. "entry too far behind"
+		return permanentError{err}
+	}
+	return err
+}
+
+// closeIgnoringError closes c an ignores errors
+func closeIgnoringError(c io.Closer) {
+	_ = c.Close()
+}
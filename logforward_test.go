@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLogEntries = []logEntry{
+	{
+		Time:     time.Date(2024, 3, 5, 18, 30, 15, 0, time.UTC),
+		Message:  "Internetverbindung wurde erfolgreich hergestellt.",
+		Line:     "05.03.24 18:30:15 Internetverbindung wurde erfolgreich hergestellt.",
+		Category: "internet",
+	},
+	{
+		Message:  "WLAN-Gerät angemeldet",
+		Line:     "WLAN-Gerät angemeldet",
+		Category: "wlan",
+	},
+}
+
+func TestLokiForwarder(t *testing.T) {
+	type pushRequest struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	requests := make(chan pushRequest, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req pushRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			t.Error(err)
+		}
+		requests <- req
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	f, err := newLogForwarder(srv.URL, "fritz.box")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	err = f.forward(testLogEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+
+	if len(req.Streams) != 2 {
+		t.Fatalf("got %d streams, want 2", len(req.Streams))
+	}
+	for i, s := range req.Streams {
+		e := testLogEntries[i]
+		want := map[string]string{"job": "fritzbox", "gateway": "fritz.box", "category": e.Category}
+		for k, v := range want {
+			if s.Stream[k] != v {
+				t.Errorf("stream %d: label %s = %q, want %q", i, k, s.Stream[k], v)
+			}
+		}
+		if len(s.Values) != 1 || s.Values[0][1] != e.Line {
+			t.Fatalf("stream %d: unexpected values %v", i, s.Values)
+		}
+
+		ns, err := strconv.ParseInt(s.Values[0][0], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := time.Unix(0, ns)
+		if !e.Time.IsZero() && !ts.Equal(e.Time) {
+			t.Errorf("stream %d: time %v, want %v", i, ts, e.Time)
+		}
+		if e.Time.IsZero() && ts.Before(before) {
+			t.Errorf("stream %d: entry without time got %v, want the time of sending", i, ts)
+		}
+	}
+}
+
+func TestLokiForwarderError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	f, err := newLogForwarder(srv.URL+"/custom/push", "fritz.box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.forward(testLogEntries)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var perm permanentError
+	if errors.As(err, &perm) {
+		t.Errorf("server error is permanent: %v", err)
+	}
+}
+
+func TestLokiForwarderRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	f, err := newLogForwarder(srv.URL, "fritz.box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.forward(testLogEntries)
+	var perm permanentError
+	if !errors.As(err, &perm) {
+		t.Fatalf("got %v, want a permanent error", err)
+	}
+	if !strings.Contains(err.Error(), "entry too far behind") {
+		t.Errorf("error without message of Loki: %v", err)
+	}
+}
+
+func TestSyslogForwarderUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeIgnoringError(conn)
+
+	f, err := newLogForwarder("syslog+udp://"+conn.LocalAddr().String(), "fritz.box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.forward(testLogEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	for _, e := range testLogEntries {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(buf[:n]), syslogMessage(e, "fritz.box"); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSyslogForwarderTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeIgnoringError(ln)
+
+	messages := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer closeIgnoringError(conn)
+
+		// octet counting framing: "<length> <message>"
+		var res []string
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			_, err = io.ReadFull(r, msg)
+			if err != nil {
+				break
+			}
+			res = append(res, string(msg))
+		}
+		messages <- res
+	}()
+
+	f, err := newLogForwarder("syslog+tcp://"+ln.Addr().String(), "fritz.box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.forward(testLogEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-messages
+	if len(got) != len(testLogEntries) {
+		t.Fatalf("got %d messages, want %d", len(got), len(testLogEntries))
+	}
+	for i, e := range testLogEntries {
+		if want := syslogMessage(e, "fritz.box"); got[i] != want {
+			t.Errorf("got %q, want %q", got[i], want)
+		}
+	}
+	if !strings.HasPrefix(got[0], "<30>1 2024-03-05T18:30:15Z fritz.box fritzbox - internet - ") {
+		t.Errorf("unexpected syslog header: %q", got[0])
+	}
+}
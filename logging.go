@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	kitlog "github.com/go-kit/log"
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// repeatInterval is the time a repeated warning or error is suppressed
+const repeatInterval = 5 * time.Minute
+
+// newLogger creates the logger for the log level (debug, info, warn, error) and format (logfmt, json).
+// Repeated warnings and errors are rate limited.
+func newLogger(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %s", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+
+	var h slog.Handler
+	switch format {
+	case "logfmt":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", format)
+	}
+
+	h = &rateLimitHandler{
+		Handler:  h,
+		interval: repeatInterval,
+		state:    &rateLimitState{seen: make(map[string]*repeatedRecord)},
+	}
+	return slog.New(h), nil
+}
+
+// errorAttrs returns the attributes of an error. UPnP errors add the error code.
+func errorAttrs(err error) []any {
+	attrs := []any{"error", err}
+
+	var soapErr *upnp.SoapError
+	if errors.As(err, &soapErr) {
+		attrs = append(attrs, "code", soapErr.Code)
+	}
+	return attrs
+}
+
+// logError logs an error and counts it as collection error.
+func logError(msg string, err error, args ...any) {
+	collectErrors.Inc()
+	slog.Error(msg, append(args, errorAttrs(err)...)...)
+}
+
+// rateLimitHandler suppresses repeated warnings and errors. A record is repeated if it has the same message and
+// attributes (except the duration). It is logged again after the interval with the number of suppressed records.
+type rateLimitHandler struct {
+	slog.Handler
+	interval time.Duration
+	prefix   string          // attributes of the handler
+	state    *rateLimitState // shared with derived handlers
+}
+
+type rateLimitState struct {
+	sync.Mutex
+	seen map[string]*repeatedRecord
+}
+
+type repeatedRecord struct {
+	logged     time.Time
+	suppressed int
+}
+
+func (h *rateLimitHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	key := h.recordKey(r)
+
+	h.state.Lock()
+	rep, ok := h.state.seen[key]
+	if ok && r.Time.Sub(rep.logged) < h.interval {
+		rep.suppressed++
+		h.state.Unlock()
+		return nil
+	}
+
+	var suppressed int
+	if ok {
+		suppressed = rep.suppressed
+	}
+	h.state.seen[key] = &repeatedRecord{logged: r.Time}
+	h.state.prune(r.Time, h.interval)
+	h.state.Unlock()
+
+	if suppressed > 0 {
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// prune removes records that are not suppressed anymore. The caller must hold the lock.
+func (s *rateLimitState) prune(now time.Time, interval time.Duration) {
+	const maxRecords = 1000
+	if len(s.seen) < maxRecords {
+		return
+	}
+	for key, rep := range s.seen {
+		if now.Sub(rep.logged) >= interval {
+			delete(s.seen, key)
+		}
+	}
+}
+
+func (h *rateLimitHandler) recordKey(r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(h.prefix)
+	b.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key != "duration" {
+			b.WriteString(" " + a.String())
+		}
+		return true
+	})
+	return b.String()
+}
+
+func (h *rateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := h.prefix
+	for _, a := range attrs {
+		prefix += a.String() + " "
+	}
+	return &rateLimitHandler{Handler: h.Handler.WithAttrs(attrs), interval: h.interval, prefix: prefix, state: h.state}
+}
+
+func (h *rateLimitHandler) WithGroup(name string) slog.Handler {
+	return &rateLimitHandler{Handler: h.Handler.WithGroup(name), interval: h.interval, prefix: h.prefix + name + ".", state: h.state}
+}
+
+// kitLogger adapts a slog logger to the go-kit logger used by the exporter toolkit.
+func kitLogger(logger *slog.Logger) kitlog.Logger {
+	return kitlog.LoggerFunc(func(keyvals ...interface{}) error {
+		level := slog.LevelInfo
+		msg := ""
+		var attrs []any
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			key := fmt.Sprint(keyvals[i])
+			switch key {
+			case "level":
+				_ = level.UnmarshalText([]byte(fmt.Sprint(keyvals[i+1])))
+			case "msg":
+				msg = fmt.Sprint(keyvals[i+1])
+			default:
+				attrs = append(attrs, key, keyvals[i+1])
+			}
+		}
+		logger.Log(context.Background(), level, msg, attrs...)
+		return nil
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	logShipBatchSize  = 100
+	logShipMaxPending = 10000 // older entries are dropped if the target is not reachable for a long time
+	logShipRetries    = 3
+)
+
+var logShipRetryDelay = 2 * time.Second // delay before the first retry; doubled for every further retry
+
+var (
+	logShipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_log_shipped_total",
+		Help: "Number of event log entries sent to the log target.",
+	})
+	logShipErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_log_ship_errors_total",
+		Help: "Number of failed attempts to read or send event log entries.",
+	})
+	logShipDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_log_ship_dropped_total",
+		Help: "Number of event log entries dropped because too many entries were pending or the log target rejected them.",
+	})
+	logShipPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "fritzbox_exporter_log_ship_pending",
+		Help: "Number of event log entries waiting to be sent.",
+	})
+
+	logShipMetrics = []prometheus.Collector{logShipped, logShipErrors, logShipDropped, logShipPending}
+)
+
+// logShipper polls the event log in the background and sends new entries to a log target.
+// It is independent of scrapes. Entries are sent in batches; failed batches are retried.
+// The dedupe state and pending entries are persisted in a state file across restarts.
+type logShipper struct {
+	reader    *deviceLogReader
+	forwarder logForwarder
+	interval  time.Duration
+	stateFile string // no persistence if empty
+
+	pending []logEntry
+}
+
+// logShipState is the content of the state file
+type logShipState struct {
+	Seen    []string   `json:"seen"`    // lines of the last read log; repeated lines occur repeatedly
+	Pending []logEntry `json:"pending"` // entries not sent yet
+}
+
+func newLogShipper(reader *deviceLogReader, forwarder logForwarder, interval time.Duration, stateFile string) *logShipper {
+	return &logShipper{
+		reader:    reader,
+		forwarder: forwarder,
+		interval:  interval,
+		stateFile: stateFile,
+	}
+}
+
+// run ships the event log. It never returns.
+func (s *logShipper) run() {
+	err := s.loadState()
+	if err != nil {
+		slog.Warn("cannot load log ship state", "error", err)
+	}
+
+	for {
+		s.poll()
+		time.Sleep(s.interval)
+	}
+}
+
+func (s *logShipper) poll() {
+	// the entries in the log at the first read are shipped as well
+	entries, _, err := s.reader.read()
+	if err != nil {
+		slog.Error("cannot read device log", errorAttrs(err)...)
+		logShipErrors.Inc()
+	}
+
+	s.add(entries)
+	s.flush()
+	logShipPending.Set(float64(len(s.pending)))
+
+	err = s.saveState()
+	if err != nil {
+		slog.Warn("cannot save log ship state", "error", err)
+	}
+}
+
+// add appends entries to the pending entries. The oldest entries are dropped if too many are pending.
+func (s *logShipper) add(entries []logEntry) {
+	s.pending = append(s.pending, entries...)
+	if drop := len(s.pending) - logShipMaxPending; drop > 0 {
+		logShipDropped.Add(float64(drop))
+		s.pending = s.pending[drop:]
+	}
+}
+
+// flush sends all pending entries in batches. Stops at the first batch that can not be sent.
+// Batches rejected by the log target are dropped.
+func (s *logShipper) flush() {
+	for len(s.pending) > 0 {
+		n := len(s.pending)
+		if n > logShipBatchSize {
+			n = logShipBatchSize
+		}
+
+		err := s.send(s.pending[:n])
+		var perm permanentError
+		if errors.As(err, &perm) {
+			slog.Error("device log rejected by the log target: entries dropped", "dropped", n, "error", err)
+			logShipDropped.Add(float64(n))
+			s.pending = s.pending[n:]
+			continue
+		}
+		if err != nil {
+			slog.Error("cannot send device log", "pending", len(s.pending), "error", err)
+			return
+		}
+
+		logShipped.Add(float64(n))
+		s.pending = s.pending[n:]
+	}
+}
+
+// send sends a batch and retries with increasing delay. Permanent errors are not retried.
+func (s *logShipper) send(batch []logEntry) error {
+	delay := logShipRetryDelay
+
+	var err error
+	for i := 0; i < logShipRetries; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		err = s.forwarder.forward(batch)
+		if err == nil {
+			return nil
+		}
+		logShipErrors.Inc()
+
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *logShipper) loadState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state logShipState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	s.pending = state.Pending
+
+	s.reader.Lock()
+	defer s.reader.Unlock()
+	for _, line := range state.Seen {
+		s.reader.seen[line]++
+	}
+	return nil
+}
+
+// saveState writes the state file atomically
+func (s *logShipper) saveState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	state := logShipState{Pending: s.pending}
+	s.reader.Lock()
+	for line, n := range s.reader.seen {
+		for i := 0; i < n; i++ {
+			state.Seen = append(state.Seen, line)
+		}
+	}
+	s.reader.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.stateFile + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.stateFile)
+}
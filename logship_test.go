@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func withFastLogShipRetries(t *testing.T) {
+	delay := logShipRetryDelay
+	logShipRetryDelay = time.Millisecond
+	t.Cleanup(func() { logShipRetryDelay = delay })
+}
+
+func TestLogShipperRetry(t *testing.T) {
+	withFastLogShipRetries(t)
+	var mu sync.Mutex
+	var requests int
+	var received []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			Streams []lokiStream `json:"streams"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		for _, s := range req.Streams {
+			for _, v := range s.Values {
+				received = append(received, v[1])
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	forwarder, err := newLogForwarder(srv.URL, "fritz.box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newLogShipper(newDeviceLogReader(nil, nil), forwarder, 0, "")
+
+	errorsBefore := testutil.ToFloat64(logShipErrors)
+	s.add(testLogEntries)
+	s.flush()
+
+	if len(s.pending) != 0 {
+		t.Errorf("%d entries pending after retry", len(s.pending))
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+	if len(received) != len(testLogEntries) {
+		t.Errorf("received %v", received)
+	}
+	if got := testutil.ToFloat64(logShipErrors) - errorsBefore; got != 1 {
+		t.Errorf("got %v errors, want 1", got)
+	}
+}
+
+func TestLogShipperRejected(t *testing.T) {
+	withFastLogShipRetries(t)
+
+	var mu sync.Mutex
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		if requests == 1 {
+			http.Error(w, "entry too far behind", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	forwarder, err := newLogForwarder(srv.URL, "fritz.box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newLogShipper(newDeviceLogReader(nil, nil), forwarder, 0, "")
+
+	droppedBefore := testutil.ToFloat64(logShipDropped)
+	sentBefore := testutil.ToFloat64(logShipped)
+	entries := make([]logEntry, logShipBatchSize+10)
+	for i := range entries {
+		entries[i].Line = strconv.Itoa(i)
+	}
+	s.add(entries)
+	s.flush()
+
+	// the rejected batch is not retried and does not block the next one
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("%d entries pending", len(s.pending))
+	}
+	if got := testutil.ToFloat64(logShipDropped) - droppedBefore; got != logShipBatchSize {
+		t.Errorf("got %v dropped, want %d", got, logShipBatchSize)
+	}
+	if got := testutil.ToFloat64(logShipped) - sentBefore; got != 10 {
+		t.Errorf("got %v shipped, want 10", got)
+	}
+}
+
+func TestLogShipperPendingCap(t *testing.T) {
+	s := newLogShipper(newDeviceLogReader(nil, nil), nil, 0, "")
+
+	droppedBefore := testutil.ToFloat64(logShipDropped)
+	entries := make([]logEntry, logShipMaxPending+10)
+	for i := range entries {
+		entries[i].Line = strconv.Itoa(i)
+	}
+	s.add(entries[:logShipMaxPending])
+	s.add(entries[logShipMaxPending:])
+
+	if len(s.pending) != logShipMaxPending {
+		t.Fatalf("got %d pending entries, want %d", len(s.pending), logShipMaxPending)
+	}
+	if s.pending[0].Line != entries[10].Line {
+		t.Errorf("oldest entries not dropped: first pending is %q", s.pending[0].Line)
+	}
+	if s.pending[len(s.pending)-1].Line != entries[len(entries)-1].Line {
+		t.Errorf("newest entry dropped")
+	}
+	if got := testutil.ToFloat64(logShipDropped) - droppedBefore; got != 10 {
+		t.Errorf("got %v dropped, want 10", got)
+	}
+}
+
+func TestLogShipperState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	lines := []string{
+		"05.03.24 18:31:00 WLAN-Gerät angemeldet",
+		"05.03.24 18:30:15 Internetverbindung wurde erfolgreich hergestellt.",
+	}
+
+	s := newLogShipper(newDeviceLogReader(nil, nil), nil, 0, stateFile)
+	entries := s.reader.newEntries(lines)
+	if len(entries) != 2 {
+		t.Fatalf("got %d new entries, want 2", len(entries))
+	}
+	s.add(entries[1:]) // the first entry was sent
+	err := s.saveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	s2 := newLogShipper(newDeviceLogReader(nil, nil), nil, 0, stateFile)
+	err = s2.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s2.pending) != 1 || s2.pending[0].Line != lines[0] {
+		t.Errorf("pending entries not restored: %v", s2.pending)
+	}
+	if !s2.pending[0].Time.Equal(entries[1].Time) {
+		t.Errorf("time not restored: %v", s2.pending[0].Time)
+	}
+	if again := s2.reader.newEntries(lines); len(again) != 0 {
+		t.Errorf("entries sent again after restart: %v", again)
+	}
+}
+
+func TestLogShipperMissingState(t *testing.T) {
+	s := newLogShipper(newDeviceLogReader(nil, nil), nil, 0, filepath.Join(t.TempDir(), "missing.json"))
+	if err := s.loadState(); err != nil {
+		t.Fatal(err)
+	}
+}
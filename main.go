@@ -15,22 +15,31 @@ package main
 // limitations under the License.
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	callmonitor "github.com/ndecker/fritzbox_exporter/fritzbox_callmonitor"
 	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
 func main() {
 	err := run()
 	if err != nil {
-		log.Fatal(err)
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 }
 
@@ -38,8 +47,64 @@ func run() error {
 	listenAddress := getEnv("FRITZBOX_EXPORTER_LISTEN", ":9133")
 	flag.StringVar(&listenAddress, "listen-address", listenAddress, "The address to listen on for HTTP requests.")
 
+	webConfigFile := getEnv("FRITZBOX_EXPORTER_WEB_CONFIG", "")
+	flag.StringVar(&webConfigFile, "web.config.file", webConfigFile, "Path to configuration file that can enable TLS or authentication.")
+	webSystemdSocket := flag.Bool("web.systemd-socket", false, "Use systemd socket activation listeners instead of port listeners (Linux only).")
+
+	logLevel := getEnv("FRITZBOX_EXPORTER_LOG_LEVEL", "info")
+	flag.StringVar(&logLevel, "log.level", logLevel, "Log level: debug, info, warn or error. Debug logs SOAP requests and responses without secrets.")
+	logFormat := getEnv("FRITZBOX_EXPORTER_LOG_FORMAT", "logfmt")
+	flag.StringVar(&logFormat, "log.format", logFormat, "Log format: logfmt or json")
+	tracingEndpoint := getEnv("FRITZBOX_EXPORTER_OTLP_ENDPOINT", "")
+	flag.StringVar(&tracingEndpoint, "tracing.endpoint", tracingEndpoint, "OTLP/HTTP endpoint to send traces of scrapes and SOAP calls to, e.g. http://localhost:4318 (empty = disabled)")
+
 	flagMetricsYamlFile := flag.String("metrics", os.Getenv("FRITZBOX_EXPORTER_METRICS"), "YAML file for metrics")
 
+	pollInterval := getEnvDuration("FRITZBOX_EXPORTER_POLL_INTERVAL", 0)
+	flag.DurationVar(&pollInterval, "poll-interval", pollInterval, "Poll the FRITZ!Box in the background with this interval instead of on every scrape (0 = disabled)")
+
+	enableAHA := getEnv("FRITZBOX_AHA", "false") == "true"
+	flag.BoolVar(&enableAHA, "aha", enableAHA, "Export smart home devices through the AHA-HTTP interface")
+
+	enableHomeauto := getEnv("FRITZBOX_HOMEAUTO", "false") == "true"
+	flag.BoolVar(&enableHomeauto, "homeauto", enableHomeauto, "Export smart home devices through the TR64 service X_AVM-DE_Homeauto")
+	homeautoAINs := getEnv("FRITZBOX_HOMEAUTO_AINS", "")
+	flag.StringVar(&homeautoAINs, "homeauto-ains", homeautoAINs, "Comma separated AINs of the smart home devices to export (default: all)")
+
+	enableCallMonitor := getEnv("FRITZBOX_CALLMONITOR", "false") == "true"
+	flag.BoolVar(&enableCallMonitor, "callmonitor", enableCallMonitor, "Export call statistics from the call monitor (enable with #96*5*)")
+	callMonitorPort := getEnvInt("FRITZBOX_CALLMONITOR_PORT", callmonitor.DefaultPort)
+	flag.IntVar(&callMonitorPort, "callmonitor-port", callMonitorPort, "The port of the FRITZ!Box call monitor")
+
+	enableCallList := getEnv("FRITZBOX_CALLLIST", "false") == "true"
+	flag.BoolVar(&enableCallList, "calllist", enableCallList, "Export call statistics from the call list (TR64 X_AVM-DE_OnTel)")
+	callListDays := getEnvInt("FRITZBOX_CALLLIST_DAYS", 1)
+	flag.IntVar(&callListDays, "calllist-days", callListDays, "Days of call history counted at startup")
+
+	enableDeviceLog := getEnv("FRITZBOX_DEVICELOG", "false") == "true"
+	flag.BoolVar(&enableDeviceLog, "devicelog", enableDeviceLog, "Export event log statistics (TR64 DeviceInfo GetDeviceLog)")
+	logRulesFile := flag.String("log-rules", os.Getenv("FRITZBOX_LOG_RULES"), "YAML file with rules to classify event log entries")
+	logForward := flag.String("log-forward", os.Getenv("FRITZBOX_LOG_FORWARD"), "Ship event log entries to stdout, syslog+udp://host:port, syslog+tcp://host:port, syslog+tls://host:port or a Loki URL")
+	logShipInterval := getEnvDuration("FRITZBOX_LOG_SHIP_INTERVAL", 1*time.Minute)
+	flag.DurationVar(&logShipInterval, "log-ship-interval", logShipInterval, "Interval to read the event log for shipping")
+	logStateFile := flag.String("log-state-file", os.Getenv("FRITZBOX_LOG_STATE_FILE"), "File to persist the event log shipping state across restarts")
+
+	pushURL := flag.String("push-url", os.Getenv("FRITZBOX_PUSH_URL"), "Push metrics to this Pushgateway or remote write URL")
+	pushMode := flag.String("push-mode", getEnv("FRITZBOX_PUSH_MODE", pushModePushgateway), "Push protocol: pushgateway or remote-write")
+	pushInterval := getEnvDuration("FRITZBOX_PUSH_INTERVAL", 1*time.Minute)
+	flag.DurationVar(&pushInterval, "push-interval", pushInterval, "Interval to push metrics")
+	pushJob := flag.String("push-job", getEnv("FRITZBOX_PUSH_JOB", "fritzbox"), "Job label of pushed metrics")
+	pushBuffer := getEnvInt("FRITZBOX_PUSH_BUFFER", 100000)
+	flag.IntVar(&pushBuffer, "push-buffer", pushBuffer, "Maximum number of samples buffered while the remote write URL is not reachable")
+
+	enablePortMappings := getEnv("FRITZBOX_PORTMAPPINGS", "false") == "true"
+	flag.BoolVar(&enablePortMappings, "portmappings", enablePortMappings, "Export port mappings and remote access settings")
+	enableHostWANAccess := getEnv("FRITZBOX_HOST_WAN_ACCESS", "false") == "true"
+	flag.BoolVar(&enableHostWANAccess, "host-wan-access", enableHostWANAccess, "Export the internet access of all active hosts with -portmappings (one call per host)")
+
+	enableWAN := getEnv("FRITZBOX_WAN_INFO", "false") == "true"
+	flag.BoolVar(&enableWAN, "wan-info", enableWAN, "Export external addresses, IPv6 prefix and DNS servers of the WAN connection")
+
 	flagTest := flag.Bool("test-metrics", false, "Test which metrics can be read and print YAML metrics file")
 
 	parameters := upnp.ConnectionParameters{
@@ -50,6 +115,12 @@ func run() error {
 		Password:        getEnv("FRITZBOX_PASSWORD", ""),
 		UseTLS:          getEnv("FRITZBOX_USE_TLS", "true") == "true",
 		AllowSelfSigned: getEnv("FRITZBOX_ALLOW_SELFSIGNED", "true") == "true",
+		AuthMethod:      getEnv("FRITZBOX_AUTH_METHOD", upnp.AuthDigest),
+		TLSPin:          getEnv("FRITZBOX_TLS_PIN", ""),
+		TLSPinFile:      getEnv("FRITZBOX_TLS_PIN_FILE", ""),
+		TLSCAFile:       getEnv("FRITZBOX_TLS_CA_FILE", ""),
+		TLSServerName:   getEnv("FRITZBOX_TLS_SERVER_NAME", ""),
+		CacheDir:        getEnv("FRITZBOX_SERVICE_CACHE_DIR", ""),
 	}
 
 	flag.StringVar(&parameters.Device, "gateway-address", parameters.Device, "The hostname or IP of the FRITZ!Box")
@@ -59,8 +130,52 @@ func run() error {
 	flag.StringVar(&parameters.Password, "password", parameters.Password, "The password for the FRITZ!Box UPnP service")
 	flag.BoolVar(&parameters.UseTLS, "use-tls", parameters.UseTLS, "Use TLS to connect to FRITZ!Box")
 	flag.BoolVar(&parameters.AllowSelfSigned, "allow-selfsigned", parameters.AllowSelfSigned, "Allow selfsigned certificate")
+	flag.StringVar(&parameters.AuthMethod, "auth-method", parameters.AuthMethod, "Authentication for TR64 actions: digest or soap")
+	flag.StringVar(&parameters.TLSPin, "tls-pin", parameters.TLSPin, "SHA-256 fingerprint of the FRITZ!Box certificate")
+	flag.StringVar(&parameters.TLSPinFile, "tls-pin-file", parameters.TLSPinFile, "File with the pinned certificate fingerprint; the first certificate is pinned if the file does not exist")
+	flag.StringVar(&parameters.TLSCAFile, "tls-ca-file", parameters.TLSCAFile, "PEM file with CA certificates to verify the FRITZ!Box certificate")
+	flag.StringVar(&parameters.TLSServerName, "tls-server-name", parameters.TLSServerName, "Server name to verify the FRITZ!Box certificate against")
+	flag.StringVar(&parameters.CacheDir, "service-cache-dir", parameters.CacheDir, "Directory to cache the service descriptions of the FRITZ!Box")
 
 	flag.Parse()
+	if len(envErrors) > 0 {
+		return errors.Join(envErrors...)
+	}
+
+	logger, err := newLogger(os.Stderr, logLevel, logFormat)
+	if err != nil {
+		return err
+	}
+	logger = logger.With("gateway", parameters.Device)
+	slog.SetDefault(logger)
+	parameters.Logger = logger
+
+	if tracingEndpoint != "" {
+		shutdown, err := setupTracing(tracingEndpoint)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = shutdown(context.Background()) }()
+	}
+
+	if parameters.CacheDir != "" {
+		err := os.MkdirAll(parameters.CacheDir, 0700)
+		if err != nil {
+			return fmt.Errorf("cannot create service cache directory: %w", err)
+		}
+	}
+
+	parameters.WrapTransport = func(t http.RoundTripper) http.RoundTripper {
+		// counts all requests including digest challenges
+		return promhttp.InstrumentRoundTripperCounter(httpRequests, t)
+	}
+	parameters.OnCertificate = func(cert *x509.Certificate) {
+		tlsCertExpiry.Set(float64(cert.NotAfter.Unix()))
+	}
+	parameters.OnPinMismatch = func(err *upnp.PinMismatchError) {
+		slog.Error("TLS pin mismatch", "expected", err.Expected, "actual", err.Actual)
+		tlsPinMismatches.Inc()
+	}
 
 	if *flagTest {
 		err := testMetrics(parameters, upnp.IGDServiceDescriptor)
@@ -69,7 +184,7 @@ func run() error {
 		}
 
 		if parameters.Username == "" {
-			log.Fatal("no username/password set for TR64")
+			return fmt.Errorf("no username/password set for TR64")
 		}
 		err = testMetrics(parameters, upnp.TR64ServiceDescriptor)
 		if err != nil {
@@ -99,15 +214,104 @@ func run() error {
 		return err
 	}
 
-	log.Printf("loaded %d metrics", len(metrics))
+	slog.Info("loaded metrics", "count", len(metrics))
 
 	collector := NewCollector(parameters, metrics)
+	if pollInterval > 0 {
+		collector.StartPolling(pollInterval)
+	}
 
-	prometheus.MustRegister(collector)
+	// the collector is registered per scrape by the metrics handler
+	err = collector.register()
+	if err != nil {
+		return err
+	}
 	prometheus.MustRegister(collectMetrics...)
 
-	http.Handle("/metrics", promhttp.Handler())
-	return http.ListenAndServe(listenAddress, nil)
+	if enableAHA {
+		if parameters.Username == "" {
+			return fmt.Errorf("no username/password set for AHA-HTTP")
+		}
+		ac, err := NewAHACollector(parameters)
+		if err != nil {
+			return err
+		}
+		prometheus.MustRegister(ac)
+	}
+	if enableCallMonitor {
+		prometheus.MustRegister(callMonitorMetrics...)
+		startCallMonitor(parameters.Device, callMonitorPort)
+	}
+	if enableCallList {
+		if parameters.Username == "" {
+			return fmt.Errorf("no username/password set for TR64")
+		}
+		prometheus.MustRegister(NewCallListCollector(collector, callListDays))
+	}
+	if enableDeviceLog || *logForward != "" {
+		if parameters.Username == "" {
+			return fmt.Errorf("no username/password set for TR64")
+		}
+		rules, err := loadLogRulesFile(*logRulesFile)
+		if err != nil {
+			return err
+		}
+
+		if enableDeviceLog {
+			prometheus.MustRegister(NewDeviceLogCollector(collector, rules))
+		}
+		if *logForward != "" {
+			forwarder, err := newLogForwarder(*logForward, parameters.Device)
+			if err != nil {
+				return err
+			}
+			prometheus.MustRegister(logShipMetrics...)
+			shipper := newLogShipper(newDeviceLogReader(collector, rules), forwarder, logShipInterval, *logStateFile)
+			go shipper.run()
+		}
+	}
+	if enableWAN {
+		prometheus.MustRegister(NewWANCollector(collector))
+	}
+	if enablePortMappings {
+		prometheus.MustRegister(NewPortMappingCollector(collector, enableHostWANAccess))
+	}
+	if enableHomeauto {
+		if parameters.Username == "" {
+			return fmt.Errorf("no username/password set for TR64")
+		}
+		prometheus.MustRegister(NewHomeautoCollector(collector, splitList(homeautoAINs)))
+	}
+
+	if *pushURL != "" {
+		target, err := newPushTarget(*pushMode, *pushURL, *pushJob, parameters.Device, pushBuffer)
+		if err != nil {
+			return err
+		}
+		gatherer, err := collector.gatherer(context.Background())
+		if err != nil {
+			return err
+		}
+		prometheus.MustRegister(pushMetrics...)
+		pusher := &metricsPusher{
+			gatherer: gatherer,
+			target:   target,
+			interval: pushInterval,
+		}
+		go pusher.run()
+	}
+
+	http.Handle("/metrics", collector.metricsHandler())
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.HandleFunc("/-/ready", collector.readyHandler)
+
+	server := &http.Server{}
+	webFlags := &web.FlagConfig{
+		WebListenAddresses: &[]string{listenAddress},
+		WebSystemdSocket:   webSystemdSocket,
+		WebConfigFile:      &webConfigFile,
+	}
+	return web.ListenAndServe(server, webFlags, kitLogger(logger))
 }
 
 func getEnv(name string, def string) string {
@@ -119,12 +323,41 @@ func getEnv(name string, def string) string {
 	}
 }
 
+// splitList splits a comma separated list. Returns nil for an empty list.
+func splitList(list string) []string {
+	var res []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// envErrors collects invalid environment variables; they are reported by run after the flags are parsed
+var envErrors []error
+
 func getEnvInt(name string, def int) int {
 	env := os.Getenv(name)
 	if env != "" {
 		val, err := strconv.Atoi(env)
 		if err != nil {
-			log.Fatalf("cannot convert %s to int", env)
+			envErrors = append(envErrors, fmt.Errorf("cannot convert %s=%s to int", name, env))
+			return def
+		}
+		return val
+	} else {
+		return def
+	}
+}
+
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	env := os.Getenv(name)
+	if env != "" {
+		val, err := time.ParseDuration(env)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("cannot convert %s=%s to duration", name, env))
+			return def
 		}
 		return val
 	} else {
@@ -7,9 +7,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"gopkg.in/yaml.v3"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 )
 
 //go:embed default-metrics.yaml
@@ -20,17 +22,41 @@ type Metric struct {
 	Help   string
 	Type   string
 
-	Service   string
+	Service string
+	// Services are alternatives to Service. The first one available on the device is used.
+	// Each service may be a regular expression, e.g. urn:schemas-upnp-org:service:WANIP(v6)?Connection:[12]
+	Services []string `yaml:",omitempty"`
+	// Instance selects service instances (regular expression), e.g. tr64desc/LANDevice:1/WLANConfiguration2.
+	Instance string `yaml:",omitempty"`
+	// Fanout exports the metric for all matching service instances with the label service_instance.
+	Fanout    bool `yaml:",omitempty"`
 	Action    string
 	Result    string
 	OkValue   string `yaml:",omitempty"`
 	LabelName string `yaml:",omitempty"`
+	// Enum exports one series per allowed value of the result with the label state.
+	// The value is 1 for the current state and 0 for all others. The allowed values are taken from the service description.
+	Enum bool `yaml:",omitempty"`
+
+	// Result64 is a 64 bit variant of Result. It is used instead of Result if the device reports it.
+	Result64 string `yaml:",omitempty"`
+	// Wrap is the bit width of a counter that wraps around (only 32 is supported).
+	// The exporter then reports a 64 bit counter.
+	Wrap int `yaml:",omitempty"`
+
+	// MinInterval is the minimum time between two calls of the action. Results are cached in between.
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
 
 	Source       string `yaml:",omitempty"`
 	ExampleValue string `yaml:",omitempty"`
 
 	metricType prometheus.ValueType
 	desc       *prometheus.Desc
+	wrap       *wrapCounter
+
+	serviceKey      string           // identifies the service alternatives and instances
+	servicePatterns []*regexp.Regexp // Service and Services as patterns
+	instancePattern *regexp.Regexp   // nil if Instance is not set
 }
 
 func (m *Metric) String() string {
@@ -39,15 +65,47 @@ func (m *Metric) String() string {
 		res.WriteString(fmt.Sprintf("%s: ", m.Metric))
 	}
 
-	res.WriteString(fmt.Sprintf("%s/%s/%s", m.Service, m.Action, m.Result))
+	service := m.Service
+	if len(m.Services) > 0 {
+		service = strings.Join(m.Services, "|")
+	}
+	res.WriteString(fmt.Sprintf("%s/%s/%s", service, m.Action, m.Result))
 
 	return res.String()
 }
 
+// metricsFile is the metrics file with settings per action. A plain list of metrics is accepted as well.
+type metricsFile struct {
+	Metrics []*Metric
+	// Actions sets options per action, keyed by service/action, e.g.
+	// urn:dslforum-org:service:DeviceInfo:1/GetInfo. The service must be written like in the metrics.
+	Actions map[string]actionOptions
+}
+
+type actionOptions struct {
+	// MinInterval is the minimum time between two calls of the action. It overrides min_interval of the metrics.
+	MinInterval time.Duration `yaml:"min_interval"`
+}
+
 func loadMetrics(data []byte) ([]*Metric, error) {
-	var metrics []*Metric
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
 
-	err := yaml.Unmarshal(data, &metrics)
+	var file metricsFile
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.SequenceNode {
+		err = doc.Content[0].Decode(&file.Metrics)
+	} else if len(doc.Content) > 0 {
+		err = doc.Content[0].Decode(&file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	metrics := file.Metrics
+
+	err = applyActionOptions(metrics, file.Actions)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +114,7 @@ func loadMetrics(data []byte) ([]*Metric, error) {
 	var metrics2 []*Metric
 	for _, m := range metrics {
 		if m.Metric == "" {
-			log.Printf("skipping metric %s: no metric name\n", m)
+			slog.Warn("skipping metric: no metric name", "metric", m)
 			continue
 		}
 
@@ -66,14 +124,40 @@ func loadMetrics(data []byte) ([]*Metric, error) {
 		case "gauge":
 			m.metricType = prometheus.GaugeValue
 		default:
-			log.Printf("skipping metric %s: invalid metric type: %s", m, m.Type)
+			slog.Warn("skipping metric: invalid metric type", "metric", m, "type", m.Type)
+			continue
+		}
+
+		err := m.compileServices()
+		if err != nil {
+			slog.Warn("skipping metric", "metric", m, "error", err)
+			continue
+		}
+
+		if m.Enum && (m.OkValue != "" || m.LabelName != "") {
+			slog.Warn("skipping metric: enum cannot be used with okvalue or labelname", "metric", m)
+			continue
+		}
+
+		switch m.Wrap {
+		case 0:
+		case 32:
+			m.wrap = newWrapCounter()
+		default:
+			slog.Warn("skipping metric: invalid wrap", "metric", m, "wrap", m.Wrap)
 			continue
 		}
 
 		labels := []string{"gateway"}
+		if m.Fanout {
+			labels = append(labels, "service_instance")
+		}
 		if m.LabelName != "" {
 			labels = append(labels, m.LabelName)
 		}
+		if m.Enum {
+			labels = append(labels, "state")
+		}
 
 		m.desc = prometheus.NewDesc(m.Metric, m.Help, labels, nil)
 		metrics2 = append(metrics2, m)
@@ -82,6 +166,84 @@ func loadMetrics(data []byte) ([]*Metric, error) {
 	return metrics2, nil
 }
 
+// applyActionOptions applies the options per action to all metrics using the action.
+func applyActionOptions(metrics []*Metric, actions map[string]actionOptions) error {
+	for key, opts := range actions {
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			return fmt.Errorf("invalid action %s: must be service/action", key)
+		}
+		service, action := key[:i], key[i+1:]
+
+		found := false
+		for _, m := range metrics {
+			if m.Action != action || (m.Service != service && !contains(m.Services, service)) {
+				continue
+			}
+			m.MinInterval = opts.MinInterval
+			found = true
+		}
+		if !found {
+			slog.Warn("action options not used by any metric", "action", key)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// compileServices compiles the service alternatives and the instance pattern.
+// Plain service types match themselves.
+func (m *Metric) compileServices() error {
+	var services []string
+	if m.Service != "" {
+		services = append(services, m.Service)
+	}
+	services = append(services, m.Services...)
+	if len(services) == 0 {
+		return fmt.Errorf("no service")
+	}
+
+	m.servicePatterns = nil
+	for _, s := range services {
+		re, err := regexp.Compile("^(?:" + s + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid service %s: %w", s, err)
+		}
+		m.servicePatterns = append(m.servicePatterns, re)
+	}
+	m.serviceKey = strings.Join(services, "|")
+
+	m.instancePattern = nil
+	if m.Instance != "" {
+		re, err := regexp.Compile("^(?:" + m.Instance + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid instance %s: %w", m.Instance, err)
+		}
+		m.instancePattern = re
+		m.serviceKey += "#" + m.Instance
+	}
+	if m.Fanout {
+		m.serviceKey += "#*"
+	}
+	return nil
+}
+
+// key identifies the action called for the metric
+func (m *Metric) key() cacheKey {
+	return cacheKey{
+		Service: m.serviceKey,
+		Action:  m.Action,
+	}
+}
+
 func writeMetrics(w io.Writer, metrics []*Metric) error {
 	data, err := yaml.Marshal(metrics)
 	if err != nil {
@@ -92,6 +254,12 @@ func writeMetrics(w io.Writer, metrics []*Metric) error {
 	return err
 }
 
+// isEnumeration reports whether allowed lists the values of an enumeration. Some devices describe
+// free-form strings with a single allowed value, which would export only one series.
+func isEnumeration(allowed []string) bool {
+	return len(allowed) > 1
+}
+
 func testMetrics(p upnp.ConnectionParameters, desc string) error {
 	root, err := upnp.LoadServiceRoot(p, desc)
 	if err != nil {
@@ -108,7 +276,7 @@ func testMetrics(p upnp.ConnectionParameters, desc string) error {
 
 			res, err := a.Call()
 			if err != nil {
-				log.Printf("unexpected error: %v\n", err)
+				slog.Warn("action call failed", append(errorAttrs(err), "service", s.ServiceType, "action", a.Name)...)
 				continue
 			}
 
@@ -124,6 +292,7 @@ func testMetrics(p upnp.ConnectionParameters, desc string) error {
 					Result:       arg.StateVariable.Name,
 					ExampleValue: fmt.Sprintf("%v", value),
 					OkValue:      "",
+					Enum:         isEnumeration(arg.StateVariable.AllowedValueList),
 					Source:       desc,
 				}
 				metrics = append(metrics, m)
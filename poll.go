@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pollResolveRetryTime is the time to wait for the services of a polled action to be loaded
+const pollResolveRetryTime = 5 * time.Second
+
+var (
+	pollAgeDesc = prometheus.NewDesc(
+		"fritzbox_exporter_poll_age_seconds",
+		"Age of the latest successful result of a polled action.",
+		[]string{"service_instance", "action"}, nil)
+	pollLastSuccessDesc = prometheus.NewDesc(
+		"fritzbox_exporter_poll_last_success_timestamp_seconds",
+		"Time of the latest successful call of a polled action.",
+		[]string{"service_instance", "action"}, nil)
+)
+
+// StartPolling decouples the calls to the FRITZ!Box from scrapes.
+// Every action is polled in the background; Collect only reports the latest results.
+// Actions are polled every interval or every min_interval of their metrics if that is longer.
+// Must be called before the collector is registered.
+//
+// The uptime of the device is polled after every action with 32 bit counters (wrap), so Collect can tell
+// wraparounds from reboots without calling the device.
+func (fc *FritzboxCollector) StartPolling(interval time.Duration) {
+	fc.pollInterval = interval
+
+	uptime := make(map[cacheKey]bool)
+	for _, m := range fc.Metrics {
+		if m.wrap != nil {
+			uptime[m.key()] = true
+		}
+	}
+
+	for key, minInterval := range fc.minIntervals {
+		actionInterval := interval
+		if minInterval > actionInterval {
+			actionInterval = minInterval
+		}
+		go fc.poll(key, actionInterval, uptime[key])
+	}
+}
+
+func (fc *FritzboxCollector) poll(key cacheKey, interval time.Duration, uptime bool) {
+	// the services are loaded in the background; wait until the action is resolved
+	for !fc.pollAction(key, uptime) {
+		time.Sleep(pollResolveRetryTime)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		fc.pollAction(key, uptime)
+	}
+}
+
+// pollAction calls the action for all resolved service instances and then reads the uptime if requested.
+// Returns false if the action is not resolved (yet).
+func (fc *FritzboxCollector) pollAction(key cacheKey, uptime bool) bool {
+	fc.RLock()
+	defer fc.RUnlock()
+
+	instances := fc.resolved[key]
+	if len(instances) == 0 {
+		return false
+	}
+
+	var numOk int
+	var lastErr error
+	for _, instance := range instances {
+		entry := fc.callAction(context.Background(), cacheKey{Service: instance, Action: key.Action}, 0)
+		if entry == nil {
+			continue
+		}
+		if entry.err != nil {
+			lastErr = entry.err
+			continue
+		}
+		numOk++
+	}
+	if numOk > 0 {
+		lastErr = nil
+	}
+	fc.setPollStatus(key, lastErr)
+
+	if service, ok := fc.services[deviceInfoService]; ok && uptime {
+		fc.callAction(context.Background(), cacheKey{Service: service.Instance, Action: "GetInfo"}, 0)
+	}
+	return true
+}
+
+// setPollStatus records the result of the latest poll of an action. The device is reachable if the latest poll
+// of any action succeeded; a single failing action does not hide the others.
+func (fc *FritzboxCollector) setPollStatus(key cacheKey, err error) {
+	fc.statusMu.Lock()
+	defer fc.statusMu.Unlock()
+
+	fc.pollStatus[key] = err
+
+	var lastErr error
+	for _, e := range fc.pollStatus {
+		if e == nil {
+			lastErr = nil
+			break
+		}
+		lastErr = e
+	}
+	fc.lastScrape = scrapeStatus{Time: time.Now(), Err: lastErr}
+}
+
+// collectPolled reports the latest polled results.
+func (fc *FritzboxCollector) collectPolled(ch chan<- prometheus.Metric) {
+	fc.RLock()
+	defer fc.RUnlock()
+
+	now := time.Now()
+	reported := make(map[cacheKey]bool)
+
+	for _, m := range fc.Metrics {
+		key := m.key()
+		for _, instance := range fc.resolved[key] {
+			callKey := cacheKey{Service: instance, Action: m.Action}
+			entry := fc.cache.latest(callKey)
+			if entry == nil {
+				continue
+			}
+
+			fc.exportResult(ch, m, key, instance, entry)
+
+			if !reported[callKey] {
+				reported[callKey] = true
+				ch <- prometheus.MustNewConstMetric(pollAgeDesc, prometheus.GaugeValue,
+					now.Sub(entry.time).Seconds(), instance, key.Action)
+				ch <- prometheus.MustNewConstMetric(pollLastSuccessDesc, prometheus.GaugeValue,
+					float64(entry.time.UnixNano())/1e9, instance, key.Action)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// services with port mappings. Each might contain the same mappings.
+var portMappingServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+	"urn:dslforum-org:service:WANIPConnection:1",
+	"urn:dslforum-org:service:WANPPPConnection:1",
+}
+
+const (
+	appSetupService   = "urn:dslforum-org:service:X_AVM-DE_AppSetup:1"
+	hostsService      = "urn:dslforum-org:service:Hosts:1"
+	hostFilterService = "urn:dslforum-org:service:X_AVM-DE_HostFilter:1"
+)
+
+// maxPortMappings limits the number of port mappings read from a service in one scrape
+const maxPortMappings = 1024
+
+// maxHosts limits the number of hosts read in one scrape
+const maxHosts = 256
+
+var (
+	portMappingInfoDesc = prometheus.NewDesc("fritzbox_port_mapping_info",
+		"Port mapping (port forwarding) of the FRITZ!Box.",
+		[]string{"gateway", "protocol", "external_port", "internal_client", "internal_port", "description", "enabled"}, nil)
+	portMappingsDesc = prometheus.NewDesc("fritzbox_port_mappings",
+		"Number of port mappings.",
+		[]string{"gateway"}, nil)
+	remoteAccessDesc = prometheus.NewDesc("fritzbox_remote_access_enabled",
+		"Remote access settings of the FRITZ!Box (X_AVM-DE_AppSetup GetAppRemoteInfo).",
+		[]string{"gateway", "setting"}, nil)
+	hostWANAccessDesc = prometheus.NewDesc("fritzbox_host_wan_access",
+		"Internet access of an active host (X_AVM-DE_HostFilter GetWANAccessByIP); 1 for the current state.",
+		[]string{"gateway", "ip", "hostname", "state"}, nil)
+	hostWANDisallowedDesc = prometheus.NewDesc("fritzbox_host_wan_disallowed",
+		"Internet access of an active host is blocked by the parental controls (X_AVM-DE_HostFilter GetWANAccessByIP).",
+		[]string{"gateway", "ip", "hostname"}, nil)
+)
+
+// PortMappingCollector exports the port mappings of all WAN connections, the remote access settings and
+// optionally the internet access of the hosts.
+type PortMappingCollector struct {
+	fc            *FritzboxCollector
+	hostWANAccess bool // export the internet access of the hosts; one call per host
+}
+
+func NewPortMappingCollector(fc *FritzboxCollector, hostWANAccess bool) *PortMappingCollector {
+	return &PortMappingCollector{fc: fc, hostWANAccess: hostWANAccess}
+}
+
+func (pc *PortMappingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- portMappingInfoDesc
+	ch <- portMappingsDesc
+	ch <- remoteAccessDesc
+	ch <- hostWANAccessDesc
+	ch <- hostWANDisallowedDesc
+}
+
+func (pc *PortMappingCollector) Collect(ch chan<- prometheus.Metric) {
+	pc.fc.RLock()
+	defer pc.fc.RUnlock()
+
+	gateway := pc.fc.Parameters.Device
+	seen := make(map[string]bool)
+	found := false
+
+	for _, serviceType := range portMappingServices {
+		service, ok := pc.fc.services[serviceType]
+		if !ok {
+			continue
+		}
+		action, ok := service.Actions["GetGenericPortMappingEntry"]
+		if !ok {
+			continue
+		}
+		found = true
+
+		err := readTable(action, "NewPortMappingIndex", maxPortMappings, func(res upnp.Result) {
+			labels := []string{
+				gateway,
+				resultString(action, res, "NewProtocol"),
+				resultString(action, res, "NewExternalPort"),
+				resultString(action, res, "NewInternalClient"),
+				resultString(action, res, "NewInternalPort"),
+				resultString(action, res, "NewPortMappingDescription"),
+				resultString(action, res, "NewEnabled"),
+			}
+
+			key := strings.Join(labels, "\x00")
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+
+			ch <- prometheus.MustNewConstMetric(portMappingInfoDesc, prometheus.GaugeValue, 1, labels...)
+		})
+		if err != nil {
+			logError("cannot read port mappings", err, "service", serviceType)
+		}
+	}
+
+	if found {
+		ch <- prometheus.MustNewConstMetric(portMappingsDesc, prometheus.GaugeValue, float64(len(seen)), gateway)
+	} else {
+		serviceNotFound.WithLabelValues(portMappingServices[0]).Inc()
+	}
+
+	pc.collectRemoteAccess(ch)
+	if pc.hostWANAccess {
+		pc.collectHostFilter(ch)
+	}
+}
+
+// collectRemoteAccess exports all boolean results of X_AVM-DE_AppSetup GetAppRemoteInfo
+func (pc *PortMappingCollector) collectRemoteAccess(ch chan<- prometheus.Metric) {
+	service, ok := pc.fc.services[appSetupService]
+	if !ok {
+		return // only available with TR64
+	}
+	action, ok := service.Actions["GetAppRemoteInfo"]
+	if !ok {
+		return
+	}
+
+	numCalls.Inc()
+	res, err := action.Call()
+	if err != nil {
+		logError("cannot read remote access info", err)
+		return
+	}
+
+	for _, arg := range action.Arguments {
+		val, ok := action.Value(res, arg.Name)
+		if !ok {
+			continue
+		}
+		if b, ok := val.(bool); ok {
+			ch <- prometheus.MustNewConstMetric(remoteAccessDesc, prometheus.GaugeValue, boolFloat(b),
+				pc.fc.Parameters.Device, strings.TrimPrefix(arg.Name, "New"))
+		}
+	}
+}
+
+// collectHostFilter exports the internet access of all active hosts with X_AVM-DE_HostFilter GetWANAccessByIP
+func (pc *PortMappingCollector) collectHostFilter(ch chan<- prometheus.Metric) {
+	filter, ok := pc.fc.services[hostFilterService]
+	if !ok {
+		return // only available with TR64
+	}
+	wanAccess, ok := filter.Actions["GetWANAccessByIP"]
+	if !ok {
+		return
+	}
+	service, ok := pc.fc.services[hostsService]
+	if !ok {
+		return
+	}
+
+	hosts, err := readHosts(service)
+	if err != nil {
+		logError("cannot read hosts", err)
+		return
+	}
+
+	gateway := pc.fc.Parameters.Device
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if !h.Active || h.IPAddress == "" || strings.Contains(h.IPAddress, ":") {
+			continue // access is only reported for active IPv4 hosts
+		}
+		key := h.IPAddress + "\x00" + h.HostName
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		numCalls.Inc()
+		access, err := wanAccess.CallWithArguments(map[string]string{"NewIPv4Address": h.IPAddress})
+		if err != nil {
+			logError("cannot read WAN access", err, "ip", h.IPAddress)
+			continue
+		}
+
+		if disallow, ok := wanAccess.Value(access, "NewDisallow"); ok {
+			if b, ok := disallow.(bool); ok {
+				ch <- prometheus.MustNewConstMetric(hostWANDisallowedDesc, prometheus.GaugeValue, boolFloat(b),
+					gateway, h.IPAddress, h.HostName)
+			}
+		}
+		state := resultString(wanAccess, access, "NewWANAccess")
+		for _, s := range []string{"granted", "denied", "error"} {
+			ch <- prometheus.MustNewConstMetric(hostWANAccessDesc, prometheus.GaugeValue, boolFloat(s == state),
+				gateway, h.IPAddress, h.HostName, s)
+		}
+	}
+}
+
+// host is an entry of the host list of the Hosts service
+type host struct {
+	IPAddress string
+	HostName  string
+	Active    bool
+}
+
+// readHosts reads the host list with a single call (X_AVM-DE_GetHostListPath) if the device supports it,
+// otherwise entry by entry with GetGenericHostEntry.
+func readHosts(service *upnp.Service) ([]host, error) {
+	if action, ok := service.Actions["X_AVM-DE_GetHostListPath"]; ok {
+		numCalls.Inc()
+		res, err := action.Call()
+		if err != nil {
+			return nil, err
+		}
+		data, err := service.Fetch(resultString(action, res, "NewX_AVM-DE_HostListPath"))
+		if err != nil {
+			return nil, err
+		}
+		return parseHostList(data)
+	}
+
+	action, ok := service.Actions["GetGenericHostEntry"]
+	if !ok {
+		actionNotFound.WithLabelValues("GetGenericHostEntry").Inc()
+		return nil, nil
+	}
+	var hosts []host
+	err := readTable(action, "NewIndex", maxHosts, func(res upnp.Result) {
+		val, _ := action.Value(res, "NewActive")
+		active, _ := val.(bool)
+		hosts = append(hosts, host{
+			IPAddress: resultString(action, res, "NewIPAddress"),
+			HostName:  resultString(action, res, "NewHostName"),
+			Active:    active,
+		})
+	})
+	return hosts, err
+}
+
+// parseHostList parses the host list file of X_AVM-DE_GetHostListPath:
+//
+//	<List><Item><IPAddress>192.168.178.20</IPAddress><HostName>pc</HostName><Active>1</Active>...</Item></List>
+func parseHostList(data []byte) ([]host, error) {
+	var list struct {
+		Items []struct {
+			IPAddress string `xml:"IPAddress"`
+			HostName  string `xml:"HostName"`
+			Active    string `xml:"Active"`
+		} `xml:"Item"`
+	}
+	err := xml.Unmarshal(data, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]host, 0, len(list.Items))
+	for _, item := range list.Items {
+		hosts = append(hosts, host{IPAddress: item.IPAddress, HostName: item.HostName, Active: item.Active == "1"})
+	}
+	return hosts, nil
+}
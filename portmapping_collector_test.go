@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseHostList(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<List>
+<Item><Index>1</Index><IPAddress>192.168.178.20</IPAddress><MACAddress>AA:BB:CC:DD:EE:01</MACAddress><Active>1</Active><HostName>laptop</HostName></Item>
+<Item><Index>2</Index><IPAddress>192.168.178.21</IPAddress><MACAddress>AA:BB:CC:DD:EE:02</MACAddress><Active>0</Active><HostName>phone</HostName></Item>
+</List>`)
+
+	hosts, err := parseHostList(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []host{
+		{IPAddress: "192.168.178.20", HostName: "laptop", Active: true},
+		{IPAddress: "192.168.178.21", HostName: "phone", Active: false},
+	}
+	if len(hosts) != len(want) {
+		t.Fatalf("got %d hosts, want %d", len(hosts), len(want))
+	}
+	for i := range want {
+		if hosts[i] != want[i] {
+			t.Errorf("host %d: got %+v, want %+v", i, hosts[i], want[i])
+		}
+	}
+}
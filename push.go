@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	pushModePushgateway = "pushgateway"
+	pushModeRemoteWrite = "remote-write"
+
+	pushBatchSize = 5000 // samples per remote write request
+	pushRetries   = 3
+	pushTimeout   = 30 * time.Second
+)
+
+var pushRetryDelay = 2 * time.Second // delay before the first retry; doubled for every further retry
+
+var (
+	pushErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_push_errors_total",
+		Help: "Number of failed attempts to push metrics.",
+	})
+	pushLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "fritzbox_exporter_push_last_success_timestamp_seconds",
+		Help: "Time of the last successful push.",
+	})
+	pushSamplesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_push_samples_sent_total",
+		Help: "Number of samples sent with remote write.",
+	})
+	pushSamplesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fritzbox_exporter_push_samples_dropped_total",
+		Help: "Number of samples dropped because the buffer was full or the remote write endpoint rejected them.",
+	})
+	pushSamplesPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "fritzbox_exporter_push_samples_pending",
+		Help: "Number of samples waiting to be sent with remote write.",
+	})
+
+	pushMetrics = []prometheus.Collector{pushErrors, pushLastSuccess, pushSamplesSent, pushSamplesDropped, pushSamplesPending}
+)
+
+// pushTarget sends gathered metrics to a central system
+type pushTarget interface {
+	push(mfs []*dto.MetricFamily, now time.Time) error
+}
+
+// newPushTarget creates a push target for a mode (pushgateway, remote-write). The series are labeled with
+// job and instance.
+func newPushTarget(mode string, url string, job string, instance string, maxPending int) (pushTarget, error) {
+	client := &http.Client{Timeout: pushTimeout}
+
+	switch mode {
+	case pushModePushgateway:
+		return &pushgatewayTarget{
+			url:      url,
+			job:      job,
+			instance: instance,
+			client:   client,
+		}, nil
+	case pushModeRemoteWrite:
+		return &remoteWriteTarget{
+			url:        url,
+			labels:     []label{{"instance", instance}, {"job", job}},
+			maxPending: maxPending,
+			client:     client,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid push mode: %s", mode)
+	}
+}
+
+// metricsPusher gathers the metrics periodically and pushes them to a target.
+// It is independent of scrapes.
+type metricsPusher struct {
+	gatherer prometheus.Gatherer
+	target   pushTarget
+	interval time.Duration
+}
+
+// run pushes the metrics. It never returns.
+func (p *metricsPusher) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.pushOnce()
+		<-ticker.C
+	}
+}
+
+func (p *metricsPusher) pushOnce() {
+	now := time.Now()
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		// the metrics that could be gathered are pushed anyway
+		slog.Warn("cannot gather all metrics for push", "error", err)
+	}
+
+	err = p.target.push(mfs, now)
+	if err != nil {
+		slog.Error("cannot push metrics", "error", err)
+		return
+	}
+	pushLastSuccess.Set(float64(now.Unix()))
+}
+
+// permanentError is an error that is not retried
+type permanentError struct {
+	error
+}
+
+// retry calls f until it succeeds with increasing delay. Permanent errors are not retried.
+func retry(f func() error) error {
+	delay := pushRetryDelay
+
+	var err error
+	for i := 0; i < pushRetries; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		err = f()
+		if err == nil {
+			return nil
+		}
+		pushErrors.Inc()
+
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return err
+		}
+	}
+	return err
+}
+
+// pushgatewayTarget replaces the metrics of the group job/instance in a Pushgateway.
+//
+// The Pushgateway only keeps the latest value of a series; nothing is buffered if it is not reachable.
+type pushgatewayTarget struct {
+	url      string
+	job      string
+	instance string
+	client   *http.Client
+}
+
+func (t *pushgatewayTarget) push(mfs []*dto.MetricFamily, _ time.Time) error {
+	// the Pushgateway rejects samples with timestamps (results cached with min_interval)
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			m.TimestampMs = nil
+		}
+	}
+
+	gathered := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return mfs, nil
+	})
+	pusher := push.New(t.url, t.job).
+		Grouping("instance", t.instance).
+		Gatherer(gathered).
+		Client(t.client)
+
+	return retry(pusher.Push)
+}
+
+// remoteWriteTarget sends samples with the Prometheus remote write protocol.
+//
+// Samples that can not be sent are buffered and sent with their original timestamps once the endpoint is
+// reachable again. If more than maxPending samples are buffered the oldest are dropped.
+type remoteWriteTarget struct {
+	url        string
+	labels     []label // added to every series
+	maxPending int
+	client     *http.Client
+
+	pending []timeSeries
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+// timeSeries is a single sample of a series
+type timeSeries struct {
+	labels    []label // sorted by name
+	value     float64
+	timestamp int64 // milliseconds since epoch
+}
+
+func (t *remoteWriteTarget) push(mfs []*dto.MetricFamily, now time.Time) error {
+	t.pending = append(t.pending, toTimeSeries(mfs, t.labels, now)...)
+	if drop := len(t.pending) - t.maxPending; drop > 0 {
+		pushSamplesDropped.Add(float64(drop))
+		t.pending = t.pending[drop:]
+	}
+	defer func() { pushSamplesPending.Set(float64(len(t.pending))) }()
+
+	return t.flush()
+}
+
+// flush sends all pending samples in batches. Stops at the first batch that can not be sent.
+func (t *remoteWriteTarget) flush() error {
+	for len(t.pending) > 0 {
+		n := len(t.pending)
+		if n > pushBatchSize {
+			n = pushBatchSize
+		}
+
+		err := retry(func() error {
+			return t.send(t.pending[:n])
+		})
+
+		var perm permanentError
+		if errors.As(err, &perm) {
+			// the endpoint will never accept the batch
+			pushSamplesDropped.Add(float64(n))
+			t.pending = t.pending[n:]
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%w (%d samples pending)", err, len(t.pending))
+		}
+
+		pushSamplesSent.Add(float64(n))
+		t.pending = t.pending[n:]
+	}
+	return nil
+}
+
+func (t *remoteWriteTarget) send(batch []timeSeries) error {
+	body := snappy.Encode(nil, encodeWriteRequest(batch))
+
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("User-Agent", "fritzbox_exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeIgnoringError(resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	err = fmt.Errorf("remote write failed: status %s", resp.Status)
+	if msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)); len(bytes.TrimSpace(msg)) > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(msg))
+	}
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		// client errors are not retried (remote write specification)
+		return permanentError{err}
+	}
+	return err
+}
+
+// toTimeSeries converts gathered metrics to samples. Summaries and histograms are split into their series
+// like in the text format. Samples without a timestamp get the time of the gathering.
+func toTimeSeries(mfs []*dto.MetricFamily, extra []label, now time.Time) []timeSeries {
+	var series []timeSeries
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			ts := now.UnixMilli()
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+
+			base := append([]label(nil), extra...)
+			for _, l := range m.Label {
+				base = append(base, label{l.GetName(), l.GetValue()})
+			}
+
+			add := func(name string, value float64, extra ...label) {
+				labels := append([]label{{"__name__", name}}, base...)
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				series = append(series, timeSeries{labels: labels, value: value, timestamp: ts})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.Quantile {
+					add(name, q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				infSeen := false
+				for _, b := range h.Bucket {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						infSeen = true
+					}
+					add(name+"_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				if !infSeen {
+					add(name+"_bucket", float64(h.GetSampleCount()), label{"le", "+Inf"})
+				}
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest of the remote write protocol:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []timeSeries) []byte {
+	var buf, ts, msg []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.labels {
+			msg = msg[:0]
+			msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.name)
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+
+		msg = msg[:0]
+		msg = protowire.AppendTag(msg, 1, protowire.Fixed64Type)
+		msg = protowire.AppendFixed64(msg, math.Float64bits(s.value))
+		msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(s.timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, msg)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// remoteWriteServer is a remote write endpoint that answers all requests with status.
+type remoteWriteServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	requests [][]decodedSeries // accepted requests
+}
+
+// decodedSeries is a TimeSeries of a remote write request
+type decodedSeries struct {
+	labels  []label
+	samples []decodedSample
+}
+
+type decodedSample struct {
+	value     float64
+	timestamp int64
+}
+
+// decodeMessage calls field for every field of a protobuf message.
+func decodeMessage(data []byte, field func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		m := protowire.ConsumeFieldValue(num, typ, data)
+		if m < 0 {
+			return protowire.ParseError(m)
+		}
+		if err := field(num, typ, data[:m]); err != nil {
+			return err
+		}
+		data = data[m:]
+	}
+	return nil
+}
+
+// bytesField returns the content of a length delimited field
+func bytesField(value []byte) ([]byte, error) {
+	b, n := protowire.ConsumeBytes(value)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	return b, nil
+}
+
+// decodeWriteRequest decodes a prometheus.WriteRequest independently of encodeWriteRequest. Unknown fields
+// are rejected.
+func decodeWriteRequest(data []byte) ([]decodedSeries, error) {
+	var series []decodedSeries
+	err := decodeMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return fmt.Errorf("WriteRequest: unexpected field %d", num)
+		}
+		tsData, err := bytesField(value)
+		if err != nil {
+			return err
+		}
+
+		var ts decodedSeries
+		err = decodeMessage(tsData, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			msg, err := bytesField(value)
+			if err != nil {
+				return err
+			}
+			switch {
+			case num == 1 && typ == protowire.BytesType:
+				var l label
+				err = decodeMessage(msg, func(num protowire.Number, typ protowire.Type, value []byte) error {
+					s, err := bytesField(value)
+					switch {
+					case err != nil:
+						return err
+					case num == 1:
+						l.name = string(s)
+					case num == 2:
+						l.value = string(s)
+					default:
+						return fmt.Errorf("Label: unexpected field %d", num)
+					}
+					return nil
+				})
+				ts.labels = append(ts.labels, l)
+			case num == 2 && typ == protowire.BytesType:
+				var s decodedSample
+				err = decodeMessage(msg, func(num protowire.Number, typ protowire.Type, value []byte) error {
+					switch {
+					case num == 1 && typ == protowire.Fixed64Type:
+						v, _ := protowire.ConsumeFixed64(value)
+						s.value = math.Float64frombits(v)
+					case num == 2 && typ == protowire.VarintType:
+						v, _ := protowire.ConsumeVarint(value)
+						s.timestamp = int64(v)
+					default:
+						return fmt.Errorf("Sample: unexpected field %d", num)
+					}
+					return nil
+				})
+				ts.samples = append(ts.samples, s)
+			default:
+				return fmt.Errorf("TimeSeries: unexpected field %d", num)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func newRemoteWriteServer(t *testing.T) *remoteWriteServer {
+	s := &remoteWriteServer{status: http.StatusNoContent}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("snappy: %v", err)
+		}
+		req, err := decodeWriteRequest(data)
+		if err != nil {
+			t.Errorf("cannot decode write request: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status/100 == 2 {
+			s.requests = append(s.requests, req)
+		}
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *remoteWriteServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// samples returns all accepted samples as "labels value@timestamp" with the labels in the order sent
+func (s *remoteWriteServer) samples() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var samples []string
+	for _, req := range s.requests {
+		for _, ts := range req {
+			var labels []string
+			for _, l := range ts.labels {
+				labels = append(labels, l.name+"="+l.value)
+			}
+			for _, sample := range ts.samples {
+				samples = append(samples, strings.Join(labels, ",")+" "+formatFloat(sample.value)+"@"+formatFloat(float64(sample.timestamp)))
+			}
+		}
+	}
+	return samples
+}
+
+func newTestRemoteWrite(t *testing.T, url string, maxPending int) *remoteWriteTarget {
+	t.Helper()
+	target, err := newPushTarget(pushModeRemoteWrite, url, "fritzbox", "fritz.box", maxPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target.(*remoteWriteTarget)
+}
+
+func gauge(name string, value float64) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name:   proto.String(name),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(value)}}},
+	}
+}
+
+func withFastRetries(t *testing.T) {
+	delay := pushRetryDelay
+	pushRetryDelay = time.Millisecond
+	t.Cleanup(func() { pushRetryDelay = delay })
+}
+
+func TestRemoteWriteEncoding(t *testing.T) {
+	srv := newRemoteWriteServer(t)
+	target := newTestRemoteWrite(t, srv.URL, 100)
+
+	mfs := []*dto.MetricFamily{
+		{
+			Name: proto.String("test_counter"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{
+					{Name: proto.String("zone"), Value: proto.String("b")},
+					{Name: proto.String("area"), Value: proto.String("a")},
+				},
+				Counter: &dto.Counter{Value: proto.Float64(3)},
+			}},
+		},
+		{
+			// cached result with the time of the call
+			Name: proto.String("test_cached"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Gauge:       &dto.Gauge{Value: proto.Float64(1)},
+				TimestampMs: proto.Int64(500),
+			}},
+		},
+		{
+			Name: proto.String("test_summary"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{Summary: &dto.Summary{
+				SampleCount: proto.Uint64(4),
+				SampleSum:   proto.Float64(10),
+				Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(2)}},
+			}}},
+		},
+		{
+			Name: proto.String("test_histogram"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(5),
+				SampleSum:   proto.Float64(7.5),
+				Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(2)}},
+			}}},
+		},
+	}
+
+	err := target.push(mfs, time.UnixMilli(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"__name__=test_counter,area=a,instance=fritz.box,job=fritzbox,zone=b 3@1000",
+		"__name__=test_cached,instance=fritz.box,job=fritzbox 1@500",
+		"__name__=test_summary,instance=fritz.box,job=fritzbox,quantile=0.5 2@1000",
+		"__name__=test_summary_sum,instance=fritz.box,job=fritzbox 10@1000",
+		"__name__=test_summary_count,instance=fritz.box,job=fritzbox 4@1000",
+		"__name__=test_histogram_bucket,instance=fritz.box,job=fritzbox,le=1 2@1000",
+		"__name__=test_histogram_bucket,instance=fritz.box,job=fritzbox,le=+Inf 5@1000",
+		"__name__=test_histogram_sum,instance=fritz.box,job=fritzbox 7.5@1000",
+		"__name__=test_histogram_count,instance=fritz.box,job=fritzbox 5@1000",
+	}
+	got := srv.samples()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got samples\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRemoteWriteBuffering(t *testing.T) {
+	withFastRetries(t)
+	srv := newRemoteWriteServer(t)
+	target := newTestRemoteWrite(t, srv.URL, 100)
+
+	srv.setStatus(http.StatusServiceUnavailable)
+	if err := target.push([]*dto.MetricFamily{gauge("test", 1)}, time.UnixMilli(1000)); err == nil {
+		t.Fatal("no error while the endpoint is unavailable")
+	}
+	if len(target.pending) != 1 {
+		t.Fatalf("%d samples pending, want 1", len(target.pending))
+	}
+
+	srv.setStatus(http.StatusNoContent)
+	if err := target.push([]*dto.MetricFamily{gauge("test", 2)}, time.UnixMilli(2000)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the buffered sample is sent with its original timestamp
+	want := "__name__=test,instance=fritz.box,job=fritzbox 1@1000\n" +
+		"__name__=test,instance=fritz.box,job=fritzbox 2@2000"
+	if got := strings.Join(srv.samples(), "\n"); got != want {
+		t.Errorf("got samples\n%s\nwant\n%s", got, want)
+	}
+	if len(target.pending) != 0 {
+		t.Errorf("%d samples pending after success", len(target.pending))
+	}
+}
+
+func TestRemoteWriteDropOnClientError(t *testing.T) {
+	withFastRetries(t)
+	srv := newRemoteWriteServer(t)
+	target := newTestRemoteWrite(t, srv.URL, 100)
+	dropped := testutil.ToFloat64(pushSamplesDropped)
+
+	srv.setStatus(http.StatusBadRequest)
+	if err := target.push([]*dto.MetricFamily{gauge("test", 1)}, time.UnixMilli(1000)); err == nil {
+		t.Fatal("no error for a rejected request")
+	}
+	if len(target.pending) != 0 {
+		t.Errorf("%d samples pending after a client error", len(target.pending))
+	}
+	if got := testutil.ToFloat64(pushSamplesDropped) - dropped; got != 1 {
+		t.Errorf("%v samples dropped, want 1", got)
+	}
+}
+
+func TestRemoteWriteMaxPending(t *testing.T) {
+	withFastRetries(t)
+	srv := newRemoteWriteServer(t)
+	target := newTestRemoteWrite(t, srv.URL, 3)
+	srv.setStatus(http.StatusServiceUnavailable)
+
+	for i := 1; i <= 5; i++ {
+		_ = target.push([]*dto.MetricFamily{gauge("test", float64(i))}, time.UnixMilli(int64(i)))
+	}
+
+	var values []float64
+	for _, s := range target.pending {
+		values = append(values, s.value)
+	}
+	// the oldest samples are dropped
+	if len(values) != 3 || values[0] != 3 || values[2] != 5 {
+		t.Errorf("pending values %v, want [3 4 5]", values)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	for v, want := range map[float64]string{0.25: "0.25", 1: "1", math.Inf(1): "+Inf", 1e21: "1e+21"} {
+		if got := formatFloat(v); got != want {
+			t.Errorf("formatFloat(%v) = %s, want %s", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// resolveServices selects the loaded service instances for every metric.
+//
+// The candidates are all services matching a service alternative (in the order of the alternatives)
+// and the instance pattern that provide the action. Fanout metrics use all candidates.
+// Otherwise, if there are several candidates, the action is called on each and the first one that reports the
+// result is used. For metrics with okvalue a candidate reporting the ok value is preferred, e.g. the connected one
+// of WANIPConnection and WANPPPConnection. Next are candidates reporting a meaningful value (not Unconfigured).
+// Probed metrics are returned in probed; they are resolved again if the selected service stops reporting a
+// meaningful value.
+func (fc *FritzboxCollector) resolveServices() (resolved map[cacheKey][]string, probed map[cacheKey]bool) {
+	resolved = make(map[cacheKey][]string)
+	probed = make(map[cacheKey]bool)
+
+	for _, m := range fc.Metrics {
+		key := m.key()
+		if _, ok := resolved[key]; ok {
+			continue // resolved for another metric using the same action
+		}
+
+		var candidates []*upnp.Service
+		var firstMatch string
+		for _, re := range m.servicePatterns {
+			for _, s := range fc.serviceList {
+				if !re.MatchString(s.ServiceType) {
+					continue
+				}
+				if m.instancePattern != nil && !m.instancePattern.MatchString(s.Instance) {
+					continue
+				}
+				if firstMatch == "" {
+					firstMatch = s.Instance
+				}
+				if _, ok := s.Actions[m.Action]; ok {
+					candidates = append(candidates, s)
+				}
+			}
+		}
+
+		switch {
+		case len(candidates) == 0 && firstMatch != "":
+			// action not found is reported on collect
+			resolved[key] = []string{firstMatch}
+		case len(candidates) == 0:
+			// service not found is reported on collect
+		case m.Fanout:
+			for _, s := range candidates {
+				resolved[key] = append(resolved[key], s.Instance)
+			}
+		case len(candidates) == 1:
+			resolved[key] = []string{candidates[0].Instance}
+		default:
+			resolved[key] = []string{probeServices(m, candidates)}
+			probed[key] = true
+		}
+
+		if len(candidates) > 1 {
+			slog.Debug("resolved services", "metric", m.Metric, "services", resolved[key])
+		}
+	}
+	return resolved, probed
+}
+
+// probeServices calls the action of m on all candidates and selects the best one: the first one reporting the ok
+// value, then the first one reporting a meaningful value, then the first one reporting the result at all.
+func probeServices(m *Metric, candidates []*upnp.Service) string {
+	const (
+		reported = iota + 1
+		meaningful
+		ok
+	)
+
+	best := candidates[0].Instance
+	bestRank := 0
+
+	for _, s := range candidates {
+		numCalls.Inc()
+		res, err := s.Actions[m.Action].Call()
+		if err != nil {
+			continue
+		}
+		val, found := res[m.Result]
+		if !found {
+			continue
+		}
+
+		rank := reported
+		switch {
+		case m.OkValue != "" && fmt.Sprint(val) == m.OkValue:
+			rank = ok
+		case meaningfulValue(val):
+			rank = meaningful
+			if m.OkValue == "" {
+				rank = ok
+			}
+		}
+
+		if rank == ok {
+			return s.Instance
+		}
+		if rank > bestRank {
+			best, bestRank = s.Instance, rank
+		}
+	}
+	return best
+}
+
+// meaningfulValue reports if a service reported a value, e.g. the status of an unused WAN connection
+// is Unconfigured.
+func meaningfulValue(val interface{}) bool {
+	s := fmt.Sprint(val)
+	return s != "" && s != "Unconfigured"
+}
+
+// checkResolved resolves the services again in the background if a probed service does not report the ok value
+// or a meaningful value, e.g. if the WAN connection was down while resolving. The services are resolved at most
+// once per resolveRetryTime. The caller must hold the read lock.
+func (fc *FritzboxCollector) checkResolved(m *Metric, key cacheKey, val interface{}) {
+	if !fc.probed[key] {
+		return
+	}
+	if m.OkValue != "" && fmt.Sprint(val) == m.OkValue || m.OkValue == "" && meaningfulValue(val) {
+		return
+	}
+
+	fc.resolveMu.Lock()
+	defer fc.resolveMu.Unlock()
+	if fc.resolving || time.Since(fc.lastResolve) < resolveRetryTime {
+		return
+	}
+	fc.resolving = true
+	fc.lastResolve = time.Now()
+
+	slog.Debug("resolving services again", "metric", m.Metric, "value", val)
+	go fc.resolveAgain()
+}
+
+func (fc *FritzboxCollector) resolveAgain() {
+	fc.RLock()
+	gen := fc.servicesGen
+	resolved, probed := fc.resolveServices()
+	fc.RUnlock()
+
+	fc.Lock()
+	if gen == fc.servicesGen {
+		// services were not replaced in the meantime
+		fc.resolved = resolved
+		fc.probed = probed
+	}
+	fc.Unlock()
+
+	fc.resolveMu.Lock()
+	fc.resolving = false
+	fc.resolveMu.Unlock()
+}
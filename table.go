@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// readTable calls a table action with increasing index until the end of the table is reached.
+func readTable(action *upnp.Action, indexArg string, max int, f func(upnp.Result)) error {
+	for i := 0; i < max; i++ {
+		numCalls.Inc()
+		res, err := action.CallWithArguments(map[string]string{indexArg: strconv.Itoa(i)})
+
+		var soapErr *upnp.SoapError
+		if errors.As(err, &soapErr) {
+			switch soapErr.Code {
+			case upnp.ErrorCodeSpecifiedArrayIndexInvalid, upnp.ErrorCodeNoSuchEntryInArray:
+				return nil // end of table
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		f(res)
+	}
+	return nil
+}
+
+// resultString returns an output argument formatted as string
+func resultString(action *upnp.Action, res upnp.Result, argument string) string {
+	val, ok := action.Value(res, argument)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%v", val)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var tracer = otel.Tracer("github.com/ndecker/fritzbox_exporter")
+
+// setupTracing sends traces to an OTLP/HTTP endpoint (e.g. http://localhost:4318).
+// The returned function flushes pending spans on shutdown.
+func setupTracing(endpoint string) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("fritzbox_exporter"))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// scrapeCollector collects the metrics of a FritzboxCollector with the context of a scrape request
+type scrapeCollector struct {
+	fc  *FritzboxCollector
+	ctx context.Context
+}
+
+func (c scrapeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.fc.Describe(ch)
+}
+
+func (c scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.fc.collect(c.ctx, ch)
+}
+
+// metricsHandler serves the metrics of the default registry and the collector. The trace context of the scrape
+// is taken from the request headers, so the Collect span is a child of the span of the scraper.
+func (fc *FritzboxCollector) metricsHandler() http.Handler {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		gatherer, err := fc.gatherer(ctx)
+		if err != nil {
+			// not expected: the metrics were checked by register
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, h)
+}
+
+// register checks the metric definitions of the collector once at startup. The collector itself is registered
+// per scrape with the context of the scrape.
+func (fc *FritzboxCollector) register() error {
+	_, err := fc.gatherer(context.Background())
+	return err
+}
+
+// gatherer gathers the metrics of the default registry and the collector with the context of a scrape.
+func (fc *FritzboxCollector) gatherer(ctx context.Context) (prometheus.Gatherer, error) {
+	reg := prometheus.NewRegistry()
+	err := reg.Register(scrapeCollector{fc: fc, ctx: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics: %w", err)
+	}
+	return prometheus.Gatherers{prometheus.DefaultGatherer, reg}, nil
+}
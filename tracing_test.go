@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const testIGDDescriptor = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<UDN>uuid:test</UDN>
+<serviceList>
+<service>
+<serviceType>urn:schemas-upnp-org:service:WANCommonInterfaceConfig:1</serviceType>
+<serviceId>urn:upnp-org:serviceId:WANCommonIFC1</serviceId>
+<controlURL>/igdupnp/control/WANCommonIFC1</controlURL>
+<eventSubURL>/igdupnp/control/WANCommonIFC1</eventSubURL>
+<SCPDURL>/igdicfgSCPD.xml</SCPDURL>
+</service>
+</serviceList>
+</device>
+</root>`
+
+const testIGDSCPD = `<?xml version="1.0"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+<actionList>
+<action>
+<name>GetTotalPacketsReceived</name>
+<argumentList>
+<argument><name>NewTotalPacketsReceived</name><direction>out</direction><relatedStateVariable>TotalPacketsReceived</relatedStateVariable></argument>
+</argumentList>
+</action>
+</actionList>
+<serviceStateTable>
+<stateVariable><name>TotalPacketsReceived</name><dataType>ui4</dataType></stateVariable>
+</serviceStateTable>
+</scpd>`
+
+const testIGDResponse = `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetTotalPacketsReceivedResponse xmlns:u="urn:schemas-upnp-org:service:WANCommonInterfaceConfig:1">
+<NewTotalPacketsReceived>4711</NewTotalPacketsReceived>
+</u:GetTotalPacketsReceivedResponse></s:Body></s:Envelope>`
+
+const testTracingMetrics = `
+- metric: gateway_wan_packets_received
+  help: packets received on gateway WAN interface
+  type: counter
+  service: urn:schemas-upnp-org:service:WANCommonInterfaceConfig:1
+  action: GetTotalPacketsReceived
+  result: TotalPacketsReceived
+`
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/igddesc.xml":
+			_, _ = io.WriteString(w, testIGDDescriptor)
+		case "/igdicfgSCPD.xml":
+			_, _ = io.WriteString(w, testIGDSCPD)
+		default:
+			_, _ = io.WriteString(w, testIGDResponse)
+		}
+	}))
+	defer device.Close()
+
+	u, err := url.Parse(device.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+
+	metrics, err := loadMetrics([]byte(testTracingMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := NewCollector(upnp.ConnectionParameters{Device: u.Hostname(), Port: port}, metrics)
+	waitForServices(t, fc)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	rec := httptest.NewRecorder()
+	fc.metricsHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape: status %d", rec.Code)
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, s := range spans {
+		if _, ok := byName[s.Name]; !ok {
+			byName[s.Name] = s
+		}
+	}
+
+	for _, name := range []string{"LoadServiceRoot", "fillServices"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("no %s span", name)
+		}
+	}
+
+	collect, ok := byName["Collect"]
+	if !ok {
+		t.Fatal("no Collect span")
+	}
+	if got := collect.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("Collect: trace id %s, want %s", got, traceID)
+	}
+	if got := collect.Parent.SpanID().String(); got != parentID {
+		t.Errorf("Collect: parent span id %s, want %s", got, parentID)
+	}
+
+	var call *tracetest.SpanStub
+	for i, s := range spans {
+		if s.Name == "Action.Call" && s.SpanContext.TraceID() == collect.SpanContext.TraceID() {
+			call = &spans[i]
+		}
+	}
+	if call == nil {
+		t.Fatal("no Action.Call span in the trace of the scrape")
+	}
+	if call.Parent.SpanID() != collect.SpanContext.SpanID() {
+		t.Error("Action.Call is not a child of Collect")
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range call.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	wantAttrs := map[attribute.Key]string{
+		"upnp.service":              "urn:schemas-upnp-org:service:WANCommonInterfaceConfig:1",
+		"upnp.action":               "GetTotalPacketsReceived",
+		"http.response.status_code": "200",
+	}
+	for key, want := range wantAttrs {
+		if got := attrs[key].Emit(); got != want {
+			t.Errorf("Action.Call: %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// waitForServices waits until the collector has loaded the IGD services.
+func waitForServices(t *testing.T, fc *FritzboxCollector) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fc.statusMu.Lock()
+		loaded := fc.igdLoaded
+		fc.statusMu.Unlock()
+		if loaded {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("services not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
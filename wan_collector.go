@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WAN connection services. Depending on the connection type (PPPoE or IP) only some report the values.
+var wanConnectionServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+	"urn:dslforum-org:service:WANIPConnection:1",
+	"urn:dslforum-org:service:WANPPPConnection:1",
+}
+
+var (
+	wanIPv4Desc = prometheus.NewDesc("fritzbox_wan_external_ipv4_info",
+		"External IPv4 address of the WAN connection.",
+		[]string{"gateway", "address"}, nil)
+	wanIPv6Desc = prometheus.NewDesc("fritzbox_wan_external_ipv6_info",
+		"External IPv6 address of the WAN connection.",
+		[]string{"gateway", "address", "prefix_length"}, nil)
+	wanIPv6PrefixDesc = prometheus.NewDesc("fritzbox_wan_ipv6_prefix_info",
+		"IPv6 prefix delegated to the FRITZ!Box.",
+		[]string{"gateway", "prefix", "prefix_length"}, nil)
+	wanDNSServerDesc = prometheus.NewDesc("fritzbox_wan_dns_server_info",
+		"DNS server of the WAN connection.",
+		[]string{"gateway", "server"}, nil)
+	wanChangesDesc = prometheus.NewDesc("fritzbox_wan_address_changes_total",
+		"Number of changes of WAN addresses detected by the exporter (kind: ipv4, ipv6, ipv6_prefix, dns).",
+		[]string{"gateway", "kind"}, nil)
+	wanLastChangeDesc = prometheus.NewDesc("fritzbox_wan_address_last_change_timestamp_seconds",
+		"Time of the last detected change of a WAN address.",
+		[]string{"gateway", "kind"}, nil)
+)
+
+// wanValue is a value of a WAN connection that is tracked for changes
+type wanValue struct {
+	value      string
+	changes    int
+	lastChange time.Time
+}
+
+// WANCollector exports external addresses, IPv6 prefix and DNS servers of the WAN connection
+// and counts their changes across scrapes.
+type WANCollector struct {
+	fc *FritzboxCollector
+
+	sync.Mutex                      // protects values
+	values     map[string]*wanValue // indexed by kind
+}
+
+func NewWANCollector(fc *FritzboxCollector) *WANCollector {
+	return &WANCollector{
+		fc:     fc,
+		values: make(map[string]*wanValue),
+	}
+}
+
+func (wc *WANCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wanIPv4Desc
+	ch <- wanIPv6Desc
+	ch <- wanIPv6PrefixDesc
+	ch <- wanDNSServerDesc
+	ch <- wanChangesDesc
+	ch <- wanLastChangeDesc
+}
+
+func (wc *WANCollector) Collect(ch chan<- prometheus.Metric) {
+	wc.fc.RLock()
+	defer wc.fc.RUnlock()
+	wc.Lock()
+	defer wc.Unlock()
+
+	gateway := wc.fc.Parameters.Device
+
+	if v := wc.call("GetExternalIPAddress", "NewExternalIPAddress"); v != nil {
+		addr := v["NewExternalIPAddress"]
+		wc.track(ch, "ipv4", addr)
+		ch <- prometheus.MustNewConstMetric(wanIPv4Desc, prometheus.GaugeValue, 1, gateway, addr)
+	}
+
+	if v := wc.call("X_AVM_DE_GetExternalIPv6Address", "NewExternalIPv6Address", "NewPrefixLength"); v != nil {
+		addr := v["NewExternalIPv6Address"]
+		wc.track(ch, "ipv6", addr)
+		ch <- prometheus.MustNewConstMetric(wanIPv6Desc, prometheus.GaugeValue, 1, gateway, addr, v["NewPrefixLength"])
+	}
+
+	if v := wc.call("X_AVM_DE_GetIPv6Prefix", "NewIPv6Prefix", "NewPrefixLength"); v != nil {
+		prefix := v["NewIPv6Prefix"]
+		wc.track(ch, "ipv6_prefix", prefix+"/"+v["NewPrefixLength"])
+		ch <- prometheus.MustNewConstMetric(wanIPv6PrefixDesc, prometheus.GaugeValue, 1, gateway, prefix, v["NewPrefixLength"])
+	}
+
+	if v := wc.call("X_AVM_DE_GetDNSServer", "NewIPv4DNSServer1", "NewIPv4DNSServer2"); v != nil {
+		var servers []string
+		for _, s := range []string{v["NewIPv4DNSServer1"], v["NewIPv4DNSServer2"]} {
+			if s != "" && s != "0.0.0.0" {
+				servers = append(servers, s)
+				ch <- prometheus.MustNewConstMetric(wanDNSServerDesc, prometheus.GaugeValue, 1, gateway, s)
+			}
+		}
+		wc.track(ch, "dns", strings.Join(servers, ","))
+	}
+}
+
+// call calls an action on the first WAN connection service that reports a non-empty value for the first result.
+// Returns the results as strings or nil if no service has a value.
+func (wc *WANCollector) call(actionName string, results ...string) map[string]string {
+	for _, serviceType := range wanConnectionServices {
+		service, ok := wc.fc.services[serviceType]
+		if !ok {
+			continue
+		}
+		action, ok := service.Actions[actionName]
+		if !ok {
+			// TR64 services use X_AVM-DE_ instead of X_AVM_DE_
+			action, ok = service.Actions[strings.Replace(actionName, "X_AVM_DE_", "X_AVM-DE_", 1)]
+		}
+		if !ok {
+			continue
+		}
+
+		numCalls.Inc()
+		res, err := action.Call()
+		if err != nil {
+			logError("action call failed", err, "service", serviceType, "action", actionName)
+			continue
+		}
+
+		values := make(map[string]string)
+		for _, r := range results {
+			values[r] = resultString(action, res, r)
+		}
+		if v := values[results[0]]; v != "" && v != "0.0.0.0" && v != "::" {
+			return values
+		}
+	}
+	return nil
+}
+
+// track counts changes of a value and exports the change metrics.
+// The first value seen after the start of the exporter is not a change.
+func (wc *WANCollector) track(ch chan<- prometheus.Metric, kind string, value string) {
+	gateway := wc.fc.Parameters.Device
+
+	v, ok := wc.values[kind]
+	if !ok {
+		v = &wanValue{value: value}
+		wc.values[kind] = v
+	} else if v.value != value {
+		v.value = value
+		v.changes++
+		v.lastChange = time.Now()
+	}
+
+	ch <- prometheus.MustNewConstMetric(wanChangesDesc, prometheus.CounterValue, float64(v.changes), gateway, kind)
+	if !v.lastChange.IsZero() {
+		ch <- prometheus.MustNewConstMetric(wanLastChangeDesc, prometheus.GaugeValue,
+			float64(v.lastChange.UnixNano())/1e9, gateway, kind)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// wrapCounter extends 32 bit counters of the FRITZ!Box to monotonic 64 bit counters
+// by counting the wraparounds between scrapes. There is a counter per service instance.
+type wrapCounter struct {
+	sync.Mutex // protects states
+	states     map[string]*wrapState
+}
+
+type wrapState struct {
+	last     uint64    // last raw value
+	lastTime time.Time // time of the call of the last raw value
+	offset   uint64    // sum of all wraparounds
+}
+
+// bootTimeFunc returns the time the device was started. It must be observed after the raw value was read.
+// ok is false if the boot time is not known.
+type bootTimeFunc func() (boot time.Time, ok bool)
+
+func newWrapCounter() *wrapCounter {
+	return &wrapCounter{states: make(map[string]*wrapState)}
+}
+
+// update records a new raw value of a service instance read at time t and returns the 64 bit counter value.
+//
+// A decreasing value is a counter reset if the device was rebooted since the last value was read; the counter then
+// starts again from the raw value. Otherwise it is a wraparound. bootTime is only called for decreasing values and
+// without holding the lock, as it may call the device.
+// If the boot time is not known a drop by more than half of the range (e.g. from 4.2e9 to 1e8) is a wraparound
+// and smaller drops are resets.
+// Values read before the last value (concurrent scrapes) are ignored; the current counter value is returned.
+func (w *wrapCounter) update(instance string, raw uint64, t time.Time, bootTime bootTimeFunc) uint64 {
+	w.Lock()
+	decreased := w.states[instance].decreased(raw, t)
+	w.Unlock()
+
+	var boot time.Time
+	var bootKnown bool
+	if decreased {
+		boot, bootKnown = bootTime()
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	s, ok := w.states[instance]
+	switch {
+	case !ok:
+		s = &wrapState{}
+		w.states[instance] = s
+	case t.Before(s.lastTime):
+		// older value of a concurrent scrape
+		return s.offset + s.last
+	case raw >= wrapRange || s.last >= wrapRange:
+		// not a 32 bit counter
+		s.offset = 0
+	case raw < s.last:
+		// if the value decreased after the boot time was read, the boot time is not known
+		if s.rebooted(raw, boot, bootKnown && decreased) {
+			s.offset = 0
+		} else {
+			s.offset += wrapRange
+		}
+	}
+
+	s.last = raw
+	s.lastTime = t
+	return s.offset + raw
+}
+
+// wrapRange is the range of the 32 bit counters
+const wrapRange = 1 << 32
+
+// decreased checks if a raw value read at time t is a decreasing 32 bit value. s may be nil.
+func (s *wrapState) decreased(raw uint64, t time.Time) bool {
+	return s != nil && !t.Before(s.lastTime) && raw < s.last && s.last < wrapRange
+}
+
+func (s *wrapState) rebooted(raw uint64, boot time.Time, bootKnown bool) bool {
+	if bootKnown {
+		return boot.After(s.lastTime)
+	}
+	return s.last-raw <= wrapRange/2
+}
+
+// toUint64 converts unsigned results. Some 64 bit values are reported as strings by the FRITZ!Box.
+func toUint64(val any) (uint64, bool) {
+	switch val := val.(type) {
+	case uint64:
+		return val, true
+	case string:
+		res, err := strconv.ParseUint(val, 10, 64)
+		return res, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWrapCounter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	unknown := func() (time.Time, bool) { return time.Time{}, false }
+	bootedAt := func(boot time.Time) bootTimeFunc {
+		return func() (time.Time, bool) { return boot, true }
+	}
+
+	type read struct {
+		raw  uint64
+		boot bootTimeFunc
+		want uint64
+	}
+
+	tests := []struct {
+		name  string
+		reads []read
+	}{
+		{"increasing", []read{
+			{100, unknown, 100},
+			{200, unknown, 200},
+		}},
+		{"wrap without uptime", []read{
+			{4_000_000_000, unknown, 4_000_000_000},
+			{100, unknown, 1<<32 + 100},
+		}},
+		{"reset without uptime", []read{
+			{1_000_000, unknown, 1_000_000},
+			{100, unknown, 100},
+		}},
+		{"large wrap with uptime", []read{
+			// more than half of the range transferred between two reads
+			{1_000_000_000, unknown, 1_000_000_000},
+			{500_000_000, bootedAt(start.Add(-24 * time.Hour)), 1<<32 + 500_000_000},
+		}},
+		{"reboot above half of the range", []read{
+			{4_000_000_000, unknown, 4_000_000_000},
+			{100, bootedAt(start.Add(30 * time.Second)), 100},
+		}},
+		{"reboot after wrap", []read{
+			{4_000_000_000, unknown, 4_000_000_000},
+			{100, bootedAt(start.Add(-24 * time.Hour)), 1<<32 + 100},
+			{50, bootedAt(start.Add(90 * time.Second)), 50},
+		}},
+		{"not a 32 bit counter", []read{
+			{1 << 40, unknown, 1 << 40},
+			{100, unknown, 100},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newWrapCounter()
+			for i, r := range tt.reads {
+				got := w.update("instance", r.raw, start.Add(time.Duration(i)*time.Minute), r.boot)
+				if got != r.want {
+					t.Errorf("read %d: got %d, want %d", i, got, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapCounterOlderValue(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	unknown := func() (time.Time, bool) { return time.Time{}, false }
+	w := newWrapCounter()
+
+	w.update("instance", 4_000_000_000, start.Add(2*time.Minute), unknown)
+	// a concurrent scrape delivers a value read before
+	if got := w.update("instance", 3_000_000_000, start.Add(time.Minute), unknown); got != 4_000_000_000 {
+		t.Errorf("older value: got %d, want 4000000000", got)
+	}
+	if got := w.update("instance", 4_100_000_000, start.Add(3*time.Minute), unknown); got != 4_100_000_000 {
+		t.Errorf("newer value: got %d, want 4100000000", got)
+	}
+}
+
+func TestWrapCounterBootTimeWithoutLock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newWrapCounter()
+	called := false
+	bootTime := func() (time.Time, bool) {
+		called = true
+		// the boot time may be read from the device; the counter must not be locked
+		if !w.TryLock() {
+			t.Error("boot time read while holding the lock")
+		} else {
+			w.Unlock()
+		}
+		return start.Add(-time.Hour), true
+	}
+
+	w.update("instance", 1000, start, bootTime)
+	if got := w.update("instance", 100, start.Add(time.Minute), bootTime); got != 1<<32+100 {
+		t.Errorf("got %d, want %d", got, uint64(1<<32+100))
+	}
+	if !called {
+		t.Error("boot time not read for a decreasing value")
+	}
+}